@@ -0,0 +1,125 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported in TrustedDigestPolicy status
+const (
+	// All images of the policy are valid and loaded in the trust store
+	ConditionReady = "Ready"
+	// The image entry is valid and loaded in the trust store
+	ConditionValid = "Valid"
+	// A running pod uses one of the digests of the image entry
+	ConditionInUse = "InUse"
+)
+
+// Condition reasons reported in TrustedDigestPolicy status
+const (
+	ReasonLoaded         = "Loaded"
+	ReasonInvalidEntries = "InvalidEntries"
+	ReasonInvalidImage   = "InvalidImage"
+	ReasonInvalidDigest  = "InvalidDigest"
+	ReasonExpired        = "Expired"
+	ReasonRunningPods    = "RunningPods"
+	ReasonNoRunningPods  = "NoRunningPods"
+)
+
+// TrustedImage is an image reference and the digests trusted for it
+type TrustedImage struct {
+	// Image reference without digest, same format as the keys of the digests mapping
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+	// Digests trusted for this image from oldest to newest, the mutating webhook injects the one chosen by mutationDigestPreference
+	// +kubebuilder:validation:MinItems=1
+	Digests []string `json:"digests"`
+	// Team owning this image, defaults to the policy owner
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// Time after which the digests are not trusted anymore
+	// +optional
+	Expires *metav1.Time `json:"expires,omitempty"`
+	// Free text notes, ex: ticket or reason of the trust
+	// +optional
+	Notes string `json:"notes,omitempty"`
+}
+
+// TrustedDigestPolicySpec defines the trusted digests of a policy
+type TrustedDigestPolicySpec struct {
+	// Team owning this policy
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// Images and their trusted digests
+	Images []TrustedImage `json:"images"`
+}
+
+// TrustedImageStatus reports the state of an image entry of the policy
+type TrustedImageStatus struct {
+	// Image reference of the entry
+	Image string `json:"image"`
+	// Conditions of the entry: Valid and InUse
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// TrustedDigestPolicyStatus defines the observed state of TrustedDigestPolicy
+type TrustedDigestPolicyStatus struct {
+	// Generation of the policy last processed
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions of the policy
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Status of each image entry
+	// +optional
+	Images []TrustedImageStatus `json:"images,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=tdp
+// +kubebuilder:printcolumn:name="Owner",type=string,JSONPath=`.spec.owner`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// TrustedDigestPolicy is a list of trusted images digests managed as a cluster resource
+type TrustedDigestPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TrustedDigestPolicySpec   `json:"spec,omitempty"`
+	Status TrustedDigestPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TrustedDigestPolicyList contains a list of TrustedDigestPolicy
+type TrustedDigestPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TrustedDigestPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TrustedDigestPolicy{}, &TrustedDigestPolicyList{})
+}
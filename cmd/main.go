@@ -38,6 +38,7 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	gomenhashaiv1alpha1 "github.com/GomenHashai/gomenhashai/api/v1alpha1"
 	"github.com/GomenHashai/gomenhashai/internal/controller"
 	"github.com/GomenHashai/gomenhashai/internal/helpers"
 	"github.com/GomenHashai/gomenhashai/internal/metrics"
@@ -52,6 +53,7 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(gomenhashaiv1alpha1.AddToScheme(scheme))
 }
 
 // nolint:gocyclo
@@ -188,6 +190,11 @@ func main() {
 	}
 	setupLog.Info("Mappings loaded")
 
+	if err := helpers.InitAudit(); err != nil {
+		setupLog.Error(err, "cannot init audit sinks")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                        scheme,
 		Metrics:                       metricsServerOptions,
@@ -210,11 +217,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// One recorder for the webhooks and the pod initializer so events share the same rate limit and duplicate cache
+	eventRecorder := helpers.NewEventRecorder(mgr.GetEventRecorderFor("gomenhashai"))
+
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = webhookcorev1.SetupPodWebhookWithManager(mgr); err != nil {
+		if err = webhookcorev1.SetupPodWebhookWithManager(mgr, eventRecorder); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
 			os.Exit(1)
 		}
+		if err = webhookcorev1.SetupWorkloadWebhooksWithManager(mgr, eventRecorder); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Workloads")
+			os.Exit(1)
+		}
 	}
 
 	if metricsCertWatcher != nil {
@@ -242,13 +256,58 @@ func main() {
 		os.Exit(1)
 	}
 
-	if helpers.CONFIG.ExistingPods.Enabled {
+	if helpers.CONFIG.ExistingPods.Enabled || helpers.CONFIG.BreakGlass.Enabled {
 		if err := mgr.Add(
 			&controller.PodInitializer{
+				Client:   mgr.GetClient(),
+				Logger:   mgr.GetLogger(),
+				Recorder: eventRecorder,
+			}); err != nil {
+			setupLog.Error(err, "🍙GomenHashai spilled the soy sauce on the logs 🍶📉")
+			os.Exit(1)
+		}
+	}
+
+	if helpers.CONFIG.Compliance.Enabled {
+		if err := mgr.Add(
+			&controller.ComplianceScanner{
+				Client:   mgr.GetClient(),
+				Logger:   mgr.GetLogger(),
+				Evaluate: webhookcorev1.EvaluatePod,
+			}); err != nil {
+			setupLog.Error(err, "🍙GomenHashai cannot keep an eye on running pods")
+			os.Exit(1)
+		}
+	}
+
+	if len(helpers.CONFIG.EnforcementWaves) > 0 {
+		if err := mgr.Add(
+			&controller.EnforcementWaveReporter{
 				Client: mgr.GetClient(),
 				Logger: mgr.GetLogger(),
 			}); err != nil {
-			setupLog.Error(err, "🍙GomenHashai spilled the soy sauce on the logs 🍶📉")
+			setupLog.Error(err, "🍙GomenHashai cannot report the enforcement waves")
+			os.Exit(1)
+		}
+	}
+
+	if helpers.CONFIG.DigestsMappingWatch {
+		if err := mgr.Add(
+			&controller.DigestMappingWatcher{
+				Logger: mgr.GetLogger(),
+			}); err != nil {
+			setupLog.Error(err, "🍙GomenHashai cannot keep an eye on the digests mapping")
+			os.Exit(1)
+		}
+	}
+
+	if helpers.CONFIG.UsesTrustSource(helpers.TrustSourcePolicies) {
+		if err = (&controller.TrustedDigestPolicyReconciler{
+			Client:  mgr.GetClient(),
+			Logger:  mgr.GetLogger(),
+			Elected: mgr.Elected(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "🍙GomenHashai failed on setup", "controller", "TrustedDigestPolicy")
 			os.Exit(1)
 		}
 	}
@@ -271,6 +330,9 @@ func main() {
 	setupLog.Info("🍙GomenHashai is warming up is nose")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "🍙GomenHashai tripped over its own paws... internal error 🐶💥")
+		helpers.CloseAudit()
 		os.Exit(1)
 	}
+	// Send the audit records still waiting in sinks
+	helpers.CloseAudit()
 }
@@ -0,0 +1,90 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ComplianceScanner periodically checks the images of running pods against the current trust configuration and exports compliance gauges
+type ComplianceScanner struct {
+	Client client.Client
+	Logger logr.Logger
+	// Return the reasons why images of the pod are not trusted, empty if the pod is compliant
+	Evaluate func(ctx context.Context, pod *corev1.Pod) []string
+}
+
+func (s *ComplianceScanner) Start(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(helpers.CONFIG.Compliance.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		s.scan(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate every running pod and replace the compliance gauges, gauges of namespaces without running pods are removed
+func (s *ComplianceScanner) scan(ctx context.Context) {
+	var podList corev1.PodList
+	if err := s.Client.List(ctx, &podList); err != nil {
+		s.Logger.Error(err, "[🐾IntegrityPatrol] cannot list pods to check compliance 😶")
+		return
+	}
+
+	compliant := map[string]int{}
+	nonCompliant := map[string]map[string]int{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		reasons := s.Evaluate(ctx, pod)
+		if len(reasons) == 0 {
+			compliant[pod.Namespace]++
+			continue
+		}
+		if nonCompliant[pod.Namespace] == nil {
+			nonCompliant[pod.Namespace] = map[string]int{}
+		}
+		for _, reason := range reasons {
+			nonCompliant[pod.Namespace][reason]++
+		}
+	}
+
+	metrics.GomenhashaiPodsCompliant.Reset()
+	metrics.GomenhashaiPodsNonCompliant.Reset()
+	for namespace, count := range compliant {
+		metrics.GomenhashaiPodsCompliant.WithLabelValues(namespace).Set(float64(count))
+	}
+	for namespace, reasons := range nonCompliant {
+		for reason, count := range reasons {
+			metrics.GomenhashaiPodsNonCompliant.WithLabelValues(namespace, reason).Set(float64(count))
+		}
+	}
+	s.Logger.Info("[🐾IntegrityPatrol] compliance of running pods checked 🍵", "pods", len(podList.Items), "nonCompliantNamespaces", len(nonCompliant))
+}
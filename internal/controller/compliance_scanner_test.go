@@ -0,0 +1,94 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Return the values of a compliance gauge by its label values joined with /
+func complianceValues(gauge *prometheus.GaugeVec) map[string]float64 {
+	collected := make(chan prometheus.Metric, 100)
+	gauge.Collect(collected)
+	close(collected)
+	values := map[string]float64{}
+	for metric := range collected {
+		written := &dto.Metric{}
+		Expect(metric.Write(written)).To(Succeed())
+		labels := []string{}
+		for _, label := range written.GetLabel() {
+			labels = append(labels, label.GetValue())
+		}
+		values[strings.Join(labels, "/")] = written.GetGauge().GetValue()
+	}
+	return values
+}
+
+var _ = Describe("Compliance scanner", func() {
+	runningPod := func(namespace string, name string, image string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+
+	It("Should replace the gauges with the compliance of running pods by namespace and reason", func(ctx SpecContext) {
+		pending := runningPod("team-a", "pending", "untrusted")
+		pending.Status.Phase = corev1.PodPending
+		podClient := fake.NewClientBuilder().WithObjects(
+			runningPod("team-a", "api", "trusted"),
+			runningPod("team-a", "worker", "trusted"),
+			runningPod("team-b", "api", "trusted"),
+			runningPod("team-b", "legacy", "untrusted"),
+			runningPod("team-b", "batch", "untrusted"),
+			pending,
+		).Build()
+		scanner := &ComplianceScanner{
+			Client: podClient,
+			Logger: logf.Log.WithName("compliance-scanner"),
+			Evaluate: func(ctx context.Context, pod *corev1.Pod) []string {
+				if pod.Spec.Containers[0].Image == "trusted" {
+					return nil
+				}
+				return []string{metrics.ReasonNoDigest, metrics.ReasonUnknownImage}
+			},
+		}
+		// Namespaces without running pods anymore are removed
+		metrics.GomenhashaiPodsCompliant.WithLabelValues("removed").Set(3)
+		metrics.GomenhashaiPodsNonCompliant.WithLabelValues("removed", metrics.ReasonNoDigest).Set(1)
+
+		scanner.scan(ctx)
+
+		Expect(complianceValues(metrics.GomenhashaiPodsCompliant)).To(Equal(map[string]float64{"team-a": 2, "team-b": 1}))
+		Expect(complianceValues(metrics.GomenhashaiPodsNonCompliant)).To(Equal(map[string]float64{
+			"team-b/" + metrics.ReasonNoDigest:     2,
+			"team-b/" + metrics.ReasonUnknownImage: 2,
+		}))
+	})
+})
@@ -0,0 +1,79 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Time between two reports, waves start at a date so the gauge follows them within this delay
+const enforcementWaveReportInterval = time.Minute
+
+// Name of the wave in metrics for namespaces in no enforcement wave
+const noEnforcementWave = "none"
+
+// EnforcementWaveReporter periodically exports the enforcement wave of every namespace
+type EnforcementWaveReporter struct {
+	Client client.Client
+	Logger logr.Logger
+}
+
+func (r *EnforcementWaveReporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(enforcementWaveReportInterval)
+	defer ticker.Stop()
+	for {
+		r.report(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replace the enforcement wave gauge with the wave of every namespace, gauges of deleted namespaces are removed
+func (r *EnforcementWaveReporter) report(ctx context.Context) {
+	var namespaceList corev1.NamespaceList
+	if err := r.Client.List(ctx, &namespaceList); err != nil {
+		r.Logger.Error(err, "[🐾IntegrityPatrol] cannot list namespaces to report enforcement waves 😶")
+		return
+	}
+
+	now := time.Now()
+	metrics.GomenhashaiEnforcementWave.Reset()
+	enforced := 0
+	for _, namespace := range namespaceList.Items {
+		wave := helpers.GetEnforcementWave(namespace.Name, namespace.Labels)
+		switch {
+		case wave == nil:
+			metrics.GomenhashaiEnforcementWave.WithLabelValues(namespace.Name, noEnforcementWave).Set(0)
+		case wave.Enforced(now):
+			metrics.GomenhashaiEnforcementWave.WithLabelValues(namespace.Name, wave.Name).Set(1)
+			enforced++
+		default:
+			metrics.GomenhashaiEnforcementWave.WithLabelValues(namespace.Name, wave.Name).Set(0)
+		}
+	}
+	r.Logger.Info("[🐾IntegrityPatrol] enforcement waves reported 🌊", "namespaces", len(namespaceList.Items), "enforcedNamespaces", enforced)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Return the values of the enforcement wave gauge by namespace/wave
+func enforcementWaveValues() map[string]float64 {
+	collected := make(chan prometheus.Metric, 100)
+	metrics.GomenhashaiEnforcementWave.Collect(collected)
+	close(collected)
+	values := map[string]float64{}
+	for metric := range collected {
+		written := &dto.Metric{}
+		Expect(metric.Write(written)).To(Succeed())
+		labels := map[string]string{}
+		for _, label := range written.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		values[labels["namespace"]+"/"+labels["wave"]] = written.GetGauge().GetValue()
+	}
+	return values
+}
+
+var _ = Describe("Enforcement wave reporter", func() {
+	BeforeEach(func() {
+		helpers.CONFIG.EnforcementWaves = []helpers.EnforcementWave{
+			{Name: "pilots", Start: "2025-01-01", NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"wave": "pilots"}}},
+			{Name: "later", Start: "2999-01-01", NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"wave": "later"}}},
+		}
+		for i := range helpers.CONFIG.EnforcementWaves {
+			Expect(helpers.CONFIG.EnforcementWaves[i].Prepare()).To(Succeed())
+		}
+		// A namespace policy overriding the validation mode does not change the wave of its namespace
+		helpers.CONFIG.NamespacePolicies = []helpers.NamespacePolicy{{Name: "payments", Namespaces: []string{"payments"}, ValidationMode: helpers.ValidationModeWarn}}
+		Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+	})
+	AfterEach(func() {
+		helpers.CONFIG.EnforcementWaves = nil
+		helpers.CONFIG.NamespacePolicies = nil
+		metrics.GomenhashaiEnforcementWave.Reset()
+	})
+
+	It("Should report the wave of every namespace", func() {
+		namespace := func(name string, wave string) *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"wave": wave}}}
+		}
+		reporter := &EnforcementWaveReporter{
+			Client: fake.NewClientBuilder().WithObjects(
+				namespace("frontend", "pilots"),
+				namespace("payments", "pilots"),
+				namespace("backend", "later"),
+				namespace("default", ""),
+			).Build(),
+			Logger: logf.Log.WithName("enforcement-wave-reporter"),
+		}
+		metrics.GomenhashaiEnforcementWave.WithLabelValues("deleted", "pilots").Set(1)
+		reporter.report(context.Background())
+		Expect(enforcementWaveValues()).To(Equal(map[string]float64{
+			"frontend/pilots": 1,
+			"payments/pilots": 1,
+			"backend/later":   0,
+			"default/none":    0,
+		}))
+	})
+})
@@ -0,0 +1,110 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// Kubelet updates mounted secrets by swapping this symlink to a new directory
+const kubeletDataDir = "..data"
+
+// Wait for events to settle before reloading, kubelet swap produces several events
+const mappingReloadDelay = 500 * time.Millisecond
+
+// DigestMappingWatcher reloads the digests mapping when the mounted file changes
+type DigestMappingWatcher struct {
+	Logger logr.Logger
+}
+
+// Every replica serves the webhook so every replica must reload its mapping
+func (w *DigestMappingWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *DigestMappingWatcher) Start(ctx context.Context) error {
+	mappingFile := filepath.Clean(helpers.CONFIG.DigestsMappingFile)
+	mappingDir := filepath.Dir(mappingFile)
+
+	// Running without mapping file is allowed, there is nothing to watch until the pod is restarted with one
+	if _, err := os.Stat(mappingDir); os.IsNotExist(err) {
+		w.Logger.Info("[🐾IntegrityPatrol] digests mapping directory does not exist, mapping is not watched ⚠️", "directory", mappingDir)
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = watcher.Close()
+	}()
+
+	// Watch the directory, the file itself is replaced and not modified when mounted from a secret
+	if err := watcher.Add(mappingDir); err != nil {
+		return err
+	}
+	w.Logger.Info("[🐾IntegrityPatrol] watching digests mapping for changes 👀", "file", mappingFile)
+
+	reload := time.NewTimer(mappingReloadDelay)
+	reload.Stop()
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name := filepath.Base(event.Name)
+			if name != filepath.Base(mappingFile) && name != kubeletDataDir {
+				continue
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			reload.Reset(mappingReloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.Logger.Error(err, "[🐾IntegrityPatrol] error while watching digests mapping", "file", mappingFile)
+		case <-reload.C:
+			w.reload(mappingFile)
+		}
+	}
+}
+
+func (w *DigestMappingWatcher) reload(mappingFile string) {
+	if err := helpers.LoadDigestMapping(); err != nil {
+		w.Logger.Error(err, "[🐾IntegrityPatrol] failed to reload digests mapping, keeping previous mapping 🍙", "file", mappingFile)
+		metrics.GomenhashaiMappingReloadFailed.Inc()
+		return
+	}
+	w.Logger.Info("[🐾IntegrityPatrol] digests mapping reloaded 🍱", "file", mappingFile, "entries", len(helpers.GetDigestMapping()))
+	metrics.GomenhashaiMappingReloaded.Inc()
+}
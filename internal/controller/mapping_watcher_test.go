@@ -0,0 +1,99 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Return the number of failed reloads of the mapping
+func mappingReloadFailed() float64 {
+	metric := &dto.Metric{}
+	Expect(metrics.GomenhashaiMappingReloadFailed.Write(metric)).To(Succeed())
+	return metric.GetCounter().GetValue()
+}
+
+var _ = Describe("Digest mapping watcher", func() {
+	var mountDir string
+	var version int
+	var previousFile string
+
+	// Write the mapping in a new directory and swap the ..data symlink to it like kubelet does for secrets
+	updateMapping := func(content string) {
+		version++
+		dataDir := filepath.Join(mountDir, "..v"+strconv.Itoa(version))
+		Expect(os.Mkdir(dataDir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dataDir, "digests_mapping.yaml"), []byte(content), 0600)).To(Succeed())
+		Expect(os.Symlink(filepath.Base(dataDir), filepath.Join(mountDir, "..data_tmp"))).To(Succeed())
+		Expect(os.Rename(filepath.Join(mountDir, "..data_tmp"), filepath.Join(mountDir, kubeletDataDir))).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		previousFile = helpers.CONFIG.DigestsMappingFile
+		mountDir = GinkgoT().TempDir()
+		version = 0
+		updateMapping(`"alpine:3": "sha256:aaaa"`)
+		Expect(os.Symlink(filepath.Join(kubeletDataDir, "digests_mapping.yaml"), filepath.Join(mountDir, "digests_mapping.yaml"))).To(Succeed())
+		helpers.CONFIG.DigestsMappingFile = filepath.Join(mountDir, "digests_mapping.yaml")
+		Expect(helpers.LoadDigestMapping()).To(Succeed())
+	})
+	AfterEach(func() {
+		helpers.CONFIG.DigestsMappingFile = previousFile
+		helpers.SetDigestMapping(map[string]helpers.DigestList{})
+	})
+
+	It("Should reload the mapping when the secret is updated", func(ctx SpecContext) {
+		watcherCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		watcher := &DigestMappingWatcher{Logger: logf.Log.WithName("mapping-watcher")}
+		done := make(chan error)
+		go func() {
+			done <- watcher.Start(watcherCtx)
+		}()
+		Expect(helpers.GetDigestMapping()).To(HaveKey("alpine:3"))
+
+		// Let the watcher start before the swap
+		time.Sleep(100 * time.Millisecond)
+		updateMapping(`"alpine:4": "sha256:bbbb"`)
+		Eventually(helpers.GetDigestMapping).WithTimeout(5 * time.Second).Should(And(HaveKey("alpine:4"), Not(HaveKey("alpine:3"))))
+
+		failed := mappingReloadFailed()
+		updateMapping(`"alpine:5": [unclosed`)
+		Eventually(mappingReloadFailed).WithTimeout(5 * time.Second).Should(Equal(failed + 1))
+		Expect(helpers.GetDigestMapping()).To(HaveKey("alpine:4"))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("Should not fail without mapping directory", func(ctx SpecContext) {
+		helpers.CONFIG.DigestsMappingFile = filepath.Join(mountDir, "missing", "digests_mapping.yaml")
+		watcher := &DigestMappingWatcher{Logger: logf.Log.WithName("mapping-watcher")}
+		Expect(watcher.Start(ctx)).To(Succeed())
+	})
+})
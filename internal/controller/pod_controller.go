@@ -19,22 +19,44 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/GomenHashai/gomenhashai/internal/helpers"
 	"github.com/GomenHashai/gomenhashai/internal/metrics"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type PodInitializer struct {
-	Client client.Client
-	Logger logr.Logger
+	Client   client.Client
+	Logger   logr.Logger
+	Recorder record.EventRecorder
 }
 
 func (r *PodInitializer) Start(ctx context.Context) error {
+	var err error
+	if helpers.CONFIG.ExistingPods.Enabled {
+		err = r.processExistingPods(ctx)
+	}
+	// Expired break-glass pods must be evicted even when some existing pods could not be processed
+	if helpers.CONFIG.BreakGlass.Enabled {
+		if err != nil {
+			r.Logger.Error(err, "[🐾IntegrityPatrol] existing pods investigation incomplete, expired break-glass pods are still evicted 🚨")
+		}
+		r.evictExpiredBreakGlassPods(ctx)
+		return nil
+	}
+	return err
+}
+
+// Update existing pods through the webhook and delete the forbidden ones
+func (r *PodInitializer) processExistingPods(ctx context.Context) error {
 	startTimeout := helpers.CONFIG.ExistingPods.StartTimeout
 	retryTimeout := helpers.CONFIG.ExistingPods.RetryTimeout
 	maxRetries := helpers.CONFIG.ExistingPods.Retries
@@ -55,6 +77,12 @@ func (r *PodInitializer) Start(ctx context.Context) error {
 		for _, pod := range pods {
 			r.Logger.Info("Process pod", "name", pod.Name)
 
+			// Pods with an expired break-glass are evicted instead of being inspected again,
+			// failed evictions (ex: blocked by a PodDisruptionBudget) are logged and retried by the periodic check
+			if evicted, err := r.evictExpiredBreakGlass(ctx, &pod); err != nil || evicted {
+				continue
+			}
+
 			updateOpts := &client.UpdateOptions{
 				FieldManager: "gomenhashai",
 			}
@@ -63,8 +91,8 @@ func (r *PodInitializer) Start(ctx context.Context) error {
 			}
 
 			if err := r.Client.Update(ctx, &pod, updateOpts); err != nil {
-				// If forbidden, it is denied by the webhook
-				if apierrors.IsForbidden(err) {
+				// If forbidden or invalid, it is denied by the webhook
+				if isDeniedByWebhook(err) {
 					r.Logger.Info("[🍣GomenHashai!] this pod is forbidden and will be gently offboarded ☁️✂️ Sayonara, pod-san.", "name", pod.Name)
 					if helpers.CONFIG.ExistingPods.DeleteEnabled {
 						if err := r.Client.Delete(ctx, &pod); err != nil {
@@ -76,7 +104,10 @@ func (r *PodInitializer) Start(ctx context.Context) error {
 							remaining = append(remaining, pod)
 							continue
 						}
-						metrics.GomenhashaiDeleted.Inc()
+						metrics.GomenhashaiDeleted.WithLabelValues(pod.Namespace).Inc()
+						if r.Recorder != nil {
+							r.Recorder.Eventf(&pod, corev1.EventTypeWarning, "PodDeleted", "Pod deleted as its images are not trusted: %v", err)
+						}
 					}
 				} else {
 					r.Logger.Error(err, "[🐾IntegrityPatrol] unexpected error occurred when updating pod, even samurai stumble sometimes ⛩️", "name", pod.Name)
@@ -106,3 +137,59 @@ func (r *PodInitializer) Start(ctx context.Context) error {
 	r.Logger.Info("[🐾IntegrityPatrol] existing pods investigation complete 🍜")
 	return nil
 }
+
+// Periodically evict pods with an expired break-glass until the context is done
+func (r *PodInitializer) evictExpiredBreakGlassPods(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(helpers.CONFIG.BreakGlass.CheckInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var podList corev1.PodList
+			if err := r.Client.List(ctx, &podList); err != nil {
+				r.Logger.Error(err, "[🐾IntegrityPatrol] cannot list pods to find expired break-glass 😶")
+				continue
+			}
+			for _, pod := range podList.Items {
+				// Errors are logged and the eviction is retried on next check
+				_, _ = r.evictExpiredBreakGlass(ctx, &pod)
+			}
+		}
+	}
+}
+
+// Evict the pod if its break-glass is expired, return if the pod was evicted
+func (r *PodInitializer) evictExpiredBreakGlass(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if !helpers.CONFIG.BreakGlass.Enabled || pod.DeletionTimestamp != nil {
+		return false, nil
+	}
+	breakGlass, err := helpers.GetBreakGlass(pod.Annotations)
+	if breakGlass == nil || err != nil || !breakGlass.Expired(time.Now()) {
+		return false, nil
+	}
+	r.Logger.Info("[🍣GomenHashai!] break-glass expired, the pod will be evicted ☁️✂️ Sayonara, pod-san.", "name", pod.Name, "namespace", pod.Namespace, "expiry", breakGlass.Expiry)
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	if err := r.Client.SubResource("eviction").Create(ctx, pod, eviction); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.Info("[🐾IntegrityPatrol] cannot find the pod to evict, it is already gone", "name", pod.Name)
+			return true, nil
+		}
+		r.Logger.Error(err, "[🐾IntegrityPatrol] is embarrassed, an error occurred when evicting pod 😶", "name", pod.Name, "namespace", pod.Namespace)
+		return false, err
+	}
+	metrics.GomenhashaiBreakGlass.WithLabelValues(pod.Namespace, "evicted").Inc()
+	if r.Recorder != nil {
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, "BreakGlassExpired", "Break-glass expired at %s, pod is evicted: %s", breakGlass.Expiry.Format(time.RFC3339), breakGlass.Reason)
+	}
+	return true, nil
+}
+
+// Return if the update was denied by the validating webhook, violations of images are reported as invalid and
+// other admission denials as forbidden. Invalid errors of the API server, ex: immutable fields, are not denials.
+func isDeniedByWebhook(err error) bool {
+	return apierrors.IsForbidden(err) || (apierrors.IsInvalid(err) && strings.Contains(err.Error(), "admission webhook"))
+}
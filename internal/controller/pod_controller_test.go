@@ -0,0 +1,92 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Pod initializer", func() {
+	var previousExistingPods helpers.ExistingPodsConfig
+	var previousBreakGlass helpers.BreakGlassConfig
+
+	BeforeEach(func() {
+		previousExistingPods = helpers.CONFIG.ExistingPods
+		previousBreakGlass = helpers.CONFIG.BreakGlass
+		helpers.CONFIG.ExistingPods = helpers.ExistingPodsConfig{Enabled: true, Retries: 2, UpdateEnabled: true, DeleteEnabled: true}
+		helpers.CONFIG.BreakGlass = helpers.BreakGlassConfig{Enabled: true, Groups: []string{"oncall"}, MaxDuration: 3600, CheckInterval: 1}
+	})
+	AfterEach(func() {
+		helpers.CONFIG.ExistingPods = previousExistingPods
+		helpers.CONFIG.BreakGlass = previousBreakGlass
+	})
+
+	It("Should keep evicting expired break-glass pods when an eviction is rejected", func(ctx SpecContext) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hotfix",
+				Namespace: "default",
+				Annotations: map[string]string{
+					helpers.BreakGlassAnnotation:       "INC-1234",
+					helpers.BreakGlassExpiryAnnotation: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+				},
+			},
+		}
+		// The PodDisruptionBudget of the pod rejects the first evictions
+		var evictions atomic.Int32
+		podClient := fake.NewClientBuilder().WithObjects(pod).WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, sub client.Object, opts ...client.SubResourceCreateOption) error {
+				if evictions.Add(1) <= 2 {
+					return apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+				}
+				return c.SubResource(subResource).Create(ctx, obj, sub, opts...)
+			},
+		}).Build()
+		initializer := &PodInitializer{Client: podClient, Logger: logf.Log.WithName("pod-initializer")}
+
+		initializerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := make(chan error)
+		go func() {
+			done <- initializer.Start(initializerCtx)
+		}()
+
+		Eventually(func() bool {
+			err := podClient.Get(ctx, types.NamespacedName{Name: "hotfix", Namespace: "default"}, &corev1.Pod{})
+			return apierrors.IsNotFound(err)
+		}).WithTimeout(5 * time.Second).Should(BeTrue())
+		Expect(evictions.Load()).To(BeNumerically(">=", 3))
+		Consistently(done).WithTimeout(100 * time.Millisecond).ShouldNot(Receive())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
@@ -0,0 +1,214 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	gomenhashaiv1alpha1 "github.com/GomenHashai/gomenhashai/api/v1alpha1"
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Refresh InUse conditions periodically as pods are not watched
+const policyResyncPeriod = 5 * time.Minute
+
+// TrustedDigestPolicyReconciler loads TrustedDigestPolicy resources into the trust store
+type TrustedDigestPolicyReconciler struct {
+	client.Client
+	Logger logr.Logger
+	// Closed when this replica is the leader, only the leader writes status
+	Elected <-chan struct{}
+}
+
+func (r *TrustedDigestPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	policy := &gomenhashaiv1alpha1.TrustedDigestPolicy{}
+	if err := r.Get(ctx, req.NamespacedName, policy); err != nil {
+		if errors.IsNotFound(err) {
+			helpers.DeletePolicyDigests(req.Name)
+			r.Logger.Info("[🐾IntegrityPatrol] trusted digest policy removed from trust store", "policy", req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	runningDigests, err := r.runningDigests(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	requeueAfter := policyResyncPeriod
+	mapping := map[string][]string{}
+	imagesStatus := make([]gomenhashaiv1alpha1.TrustedImageStatus, 0, len(policy.Spec.Images))
+	invalidCount := 0
+
+	for _, entry := range policy.Spec.Images {
+		imageStatus := gomenhashaiv1alpha1.TrustedImageStatus{Image: entry.Image}
+		// Keep transition times of unchanged conditions
+		for _, previous := range policy.Status.Images {
+			if previous.Image == entry.Image {
+				imageStatus.Conditions = previous.Conditions
+				break
+			}
+		}
+
+		valid := metav1.Condition{
+			Type:               gomenhashaiv1alpha1.ConditionValid,
+			Status:             metav1.ConditionTrue,
+			Reason:             gomenhashaiv1alpha1.ReasonLoaded,
+			Message:            "digests are loaded in the trust store",
+			ObservedGeneration: policy.Generation,
+		}
+		if reason, message := validateTrustedImage(entry, now); reason != "" {
+			valid.Status = metav1.ConditionFalse
+			valid.Reason = reason
+			valid.Message = message
+			invalidCount++
+		} else {
+			mapping[entry.Image] = append(mapping[entry.Image], entry.Digests...)
+			// Reload the policy when the entry expires
+			if entry.Expires != nil && entry.Expires.Sub(now) < requeueAfter {
+				requeueAfter = entry.Expires.Sub(now)
+			}
+		}
+		meta.SetStatusCondition(&imageStatus.Conditions, valid)
+
+		inUse := metav1.Condition{
+			Type:               gomenhashaiv1alpha1.ConditionInUse,
+			Status:             metav1.ConditionFalse,
+			Reason:             gomenhashaiv1alpha1.ReasonNoRunningPods,
+			Message:            "no running pod uses these digests",
+			ObservedGeneration: policy.Generation,
+		}
+		for _, digest := range entry.Digests {
+			if count := runningDigests[digest]; count > 0 {
+				inUse.Status = metav1.ConditionTrue
+				inUse.Reason = gomenhashaiv1alpha1.ReasonRunningPods
+				inUse.Message = fmt.Sprintf("%d running containers use these digests", count)
+				break
+			}
+		}
+		meta.SetStatusCondition(&imageStatus.Conditions, inUse)
+
+		imagesStatus = append(imagesStatus, imageStatus)
+	}
+
+	helpers.SetPolicyDigests(policy.Name, mapping)
+	r.Logger.Info("[🐾IntegrityPatrol] trusted digest policy loaded in trust store 🍱", "policy", policy.Name, "images", len(mapping), "invalid", invalidCount)
+
+	if !r.isLeader() {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	ready := metav1.Condition{
+		Type:               gomenhashaiv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             gomenhashaiv1alpha1.ReasonLoaded,
+		Message:            "all images are loaded in the trust store",
+		ObservedGeneration: policy.Generation,
+	}
+	if invalidCount > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = gomenhashaiv1alpha1.ReasonInvalidEntries
+		ready.Message = fmt.Sprintf("%d images are not valid and were not loaded", invalidCount)
+	}
+	meta.SetStatusCondition(&policy.Status.Conditions, ready)
+	policy.Status.Images = imagesStatus
+	policy.Status.ObservedGeneration = policy.Generation
+
+	if err := r.Status().Update(ctx, policy); err != nil {
+		r.Logger.Error(err, "[🐾IntegrityPatrol] failed to update trusted digest policy status", "policy", policy.Name)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// Return the reason and message why the entry cannot be trusted or empty reason
+func validateTrustedImage(entry gomenhashaiv1alpha1.TrustedImage, now time.Time) (string, string) {
+	if helpers.GetDigest(entry.Image) != "" {
+		return gomenhashaiv1alpha1.ReasonInvalidImage, "image must not contain a digest"
+	}
+	if _, err := name.ParseReference(entry.Image); err != nil {
+		return gomenhashaiv1alpha1.ReasonInvalidImage, fmt.Sprintf("image is not a valid reference: %v", err)
+	}
+	if len(entry.Digests) == 0 {
+		return gomenhashaiv1alpha1.ReasonInvalidDigest, "at least one digest is required"
+	}
+	for _, digest := range entry.Digests {
+		if !helpers.IsValidDigest(digest) {
+			return gomenhashaiv1alpha1.ReasonInvalidDigest, fmt.Sprintf("digest %q is not valid", digest)
+		}
+	}
+	if entry.Expires != nil && !entry.Expires.After(now) {
+		return gomenhashaiv1alpha1.ReasonExpired, fmt.Sprintf("trust expired at %s", entry.Expires.Format(time.RFC3339))
+	}
+	return "", ""
+}
+
+// Count running containers by image digest
+func (r *TrustedDigestPolicyReconciler) runningDigests(ctx context.Context) (map[string]int, error) {
+	var podList corev1.PodList
+	if err := r.List(ctx, &podList); err != nil {
+		return nil, err
+	}
+	digests := map[string]int{}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+			if digest := helpers.GetDigest(container.Image); digest != "" {
+				digests[digest]++
+			}
+		}
+	}
+	return digests, nil
+}
+
+func (r *TrustedDigestPolicyReconciler) isLeader() bool {
+	select {
+	case <-r.Elected:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *TrustedDigestPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gomenhashaiv1alpha1.TrustedDigestPolicy{}).
+		// Every replica serves the webhook so every replica must load policies
+		WithOptions(ctrlcontroller.Options{NeedLeaderElection: ptr.To(false)}).
+		// Status updates do not change the trust store
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
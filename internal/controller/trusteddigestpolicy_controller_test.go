@@ -0,0 +1,160 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	gomenhashaiv1alpha1 "github.com/GomenHashai/gomenhashai/api/v1alpha1"
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("TrustedDigestPolicy controller", func() {
+	const (
+		trustedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		expiredDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	var (
+		policy     *gomenhashaiv1alpha1.TrustedDigestPolicy
+		policyKey  = types.NamespacedName{Name: "team-payments"}
+		request    = ctrl.Request{NamespacedName: policyKey}
+		k8sClient  client.Client
+		reconciler *TrustedDigestPolicyReconciler
+		elected    chan struct{}
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(gomenhashaiv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		policy = &gomenhashaiv1alpha1.TrustedDigestPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: policyKey.Name, Generation: 1},
+			Spec: gomenhashaiv1alpha1.TrustedDigestPolicySpec{
+				Owner: "payments",
+				Images: []gomenhashaiv1alpha1.TrustedImage{
+					{Image: "payments/api:1", Digests: []string{trustedDigest}, Expires: &metav1.Time{Time: time.Now().Add(time.Minute)}},
+					{Image: "payments/worker:1@" + trustedDigest, Digests: []string{trustedDigest}},
+					{Image: "payments/batch:1", Digests: []string{"sha256:NOTADIGEST"}},
+					{Image: "payments/legacy:1", Digests: []string{expiredDigest}, Expires: &metav1.Time{Time: time.Now().Add(-time.Minute)}},
+				},
+			},
+		}
+		runningPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "api", Image: "payments/api:1@" + trustedDigest}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(policy, runningPod).
+			WithStatusSubresource(&gomenhashaiv1alpha1.TrustedDigestPolicy{}).
+			Build()
+		elected = make(chan struct{})
+		reconciler = &TrustedDigestPolicyReconciler{Client: k8sClient, Logger: logf.Log.WithName("trusted-digest-policy"), Elected: elected}
+	})
+	AfterEach(func() {
+		helpers.DeletePolicyDigests(policyKey.Name)
+	})
+
+	// Return the condition of the status of the image entry
+	imageCondition := func(status gomenhashaiv1alpha1.TrustedDigestPolicyStatus, image string, conditionType string) *metav1.Condition {
+		for _, imageStatus := range status.Images {
+			if imageStatus.Image == image {
+				return meta.FindStatusCondition(imageStatus.Conditions, conditionType)
+			}
+		}
+		return nil
+	}
+
+	It("Should load valid entries and report conditions as leader", func(ctx SpecContext) {
+		close(elected)
+		result, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/api:1")).To(ConsistOf(trustedDigest))
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/batch:1")).To(BeEmpty())
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/legacy:1")).To(BeEmpty())
+		// The policy is reloaded when its first entry expires
+		Expect(result.RequeueAfter).To(And(BeNumerically(">", 0), BeNumerically("<=", time.Minute)))
+
+		updated := &gomenhashaiv1alpha1.TrustedDigestPolicy{}
+		Expect(k8sClient.Get(ctx, policyKey, updated)).To(Succeed())
+		Expect(updated.Status.ObservedGeneration).To(Equal(int64(1)))
+		ready := meta.FindStatusCondition(updated.Status.Conditions, gomenhashaiv1alpha1.ConditionReady)
+		Expect(ready).ToNot(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal(gomenhashaiv1alpha1.ReasonInvalidEntries))
+		Expect(ready.Message).To(HavePrefix("3 images"))
+
+		Expect(imageCondition(updated.Status, "payments/api:1", gomenhashaiv1alpha1.ConditionValid).Status).To(Equal(metav1.ConditionTrue))
+		Expect(imageCondition(updated.Status, "payments/api:1", gomenhashaiv1alpha1.ConditionInUse).Reason).To(Equal(gomenhashaiv1alpha1.ReasonRunningPods))
+		Expect(imageCondition(updated.Status, "payments/worker:1@"+trustedDigest, gomenhashaiv1alpha1.ConditionValid).Reason).To(Equal(gomenhashaiv1alpha1.ReasonInvalidImage))
+		Expect(imageCondition(updated.Status, "payments/batch:1", gomenhashaiv1alpha1.ConditionValid).Reason).To(Equal(gomenhashaiv1alpha1.ReasonInvalidDigest))
+		Expect(imageCondition(updated.Status, "payments/legacy:1", gomenhashaiv1alpha1.ConditionValid).Reason).To(Equal(gomenhashaiv1alpha1.ReasonExpired))
+		Expect(imageCondition(updated.Status, "payments/legacy:1", gomenhashaiv1alpha1.ConditionInUse).Reason).To(Equal(gomenhashaiv1alpha1.ReasonNoRunningPods))
+	})
+
+	It("Should report Ready when all entries are valid", func(ctx SpecContext) {
+		close(elected)
+		policy.Spec.Images = policy.Spec.Images[:1]
+		Expect(k8sClient.Update(ctx, policy)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+
+		updated := &gomenhashaiv1alpha1.TrustedDigestPolicy{}
+		Expect(k8sClient.Get(ctx, policyKey, updated)).To(Succeed())
+		ready := meta.FindStatusCondition(updated.Status.Conditions, gomenhashaiv1alpha1.ConditionReady)
+		Expect(ready).ToNot(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+		Expect(ready.Reason).To(Equal(gomenhashaiv1alpha1.ReasonLoaded))
+	})
+
+	It("Should load the trust store without writing status on other replicas", func(ctx SpecContext) {
+		result, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/api:1")).To(ConsistOf(trustedDigest))
+
+		updated := &gomenhashaiv1alpha1.TrustedDigestPolicy{}
+		Expect(k8sClient.Get(ctx, policyKey, updated)).To(Succeed())
+		Expect(updated.Status.Conditions).To(BeEmpty())
+		Expect(updated.Status.Images).To(BeEmpty())
+	})
+
+	It("Should remove the digests of a deleted policy from the trust store", func(ctx SpecContext) {
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/api:1")).ToNot(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, policy)).To(Succeed())
+		result, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(helpers.GetTrustedDigestsFromPolicies("payments/api:1")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,411 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+var auditlog = logf.Log.WithName("audit")
+
+// Verdicts of the decisions on the image of a container
+const (
+	AuditVerdictMutated    = "mutated"
+	AuditVerdictUnchanged  = "unchanged"
+	AuditVerdictExempt     = "exempt"
+	AuditVerdictError      = "error"
+	AuditVerdictAllowed    = "allowed"
+	AuditVerdictDenied     = "denied"
+	AuditVerdictWarned     = "warned"
+	AuditVerdictAudited    = "audited"
+	AuditVerdictBreakGlass = "break_glass"
+)
+
+// Names of the sinks in metrics
+const (
+	auditSinkFile   = "file"
+	auditSinkStdout = "stdout"
+	auditSinkHTTP   = "http"
+)
+
+type AuditConfig struct {
+	// Append records to a local file rotated by size
+	File AuditFileConfig `yaml:"file"`
+	// Write records to the standard output of GomenHashai
+	Stdout AuditStdoutConfig `yaml:"stdout"`
+	// Send records in batches to an HTTP endpoint
+	HTTP AuditHTTPConfig `yaml:"http"`
+}
+
+type AuditFileConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path of the file, rotated files are suffixed with .1, .2...
+	Path string `yaml:"path" validate:"required_if=Enabled true"`
+	// Size of the file in megabytes before it is rotated
+	MaxSize int `yaml:"maxSize" validate:"gt=0"`
+	// Number of rotated files to keep
+	MaxBackups int `yaml:"maxBackups" validate:"gte=0"`
+}
+
+type AuditStdoutConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type AuditHTTPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint receiving records as a JSON array with POST requests
+	URL string `yaml:"url" validate:"required_if=Enabled true,omitempty,url"`
+	// Headers added to requests ex: Authorization
+	Headers map[string]string `yaml:"headers"`
+	// Maximum number of records sent in one request
+	BatchSize int `yaml:"batchSize" validate:"gt=0"`
+	// Time before records are sent when the batch is not full in seconds
+	FlushInterval int `yaml:"flushInterval" validate:"gt=0"`
+	// Number of retries of a failed request, the batch is dropped after the last one
+	Retries int `yaml:"retries" validate:"gte=0"`
+	// Time before the first retry in seconds, doubled for each retry
+	RetryInterval int `yaml:"retryInterval" validate:"gt=0"`
+	// Timeout of requests in seconds
+	Timeout int `yaml:"timeout" validate:"gt=0"`
+	// Maximum number of records waiting to be sent, additional records are dropped
+	QueueSize int `yaml:"queueSize" validate:"gt=0"`
+}
+
+// AuditRecord is the decision of a webhook on the image of a container
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Webhook taking the decision: mutation or validation
+	Webhook    string `json:"webhook"`
+	RequestUID string `json:"requestUID,omitempty"`
+	User       string `json:"user,omitempty"`
+	Operation  string `json:"operation"`
+	Namespace  string `json:"namespace"`
+	// Resource and name of the pod or workload holding the container
+	Resource      string `json:"resource"`
+	Name          string `json:"name"`
+	Container     string `json:"container"`
+	OriginalImage string `json:"originalImage"`
+	MutatedImage  string `json:"mutatedImage,omitempty"`
+	TrustedDigest string `json:"trustedDigest,omitempty"`
+	// Trust source that knew the image
+	Source  string `json:"source,omitempty"`
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+	// Validation mode or mutation mode (enforce or dryRun)
+	Mode string `json:"mode"`
+	// The admission request was a dry-run and nothing was persisted
+	DryRun bool `json:"dryRun"`
+}
+
+// AuditSink writes audit records
+type AuditSink interface {
+	Write(record AuditRecord) error
+	// Write pending records and release resources
+	Close() error
+}
+
+var (
+	auditSinks     []AuditSink
+	auditSinksLock sync.RWMutex
+)
+
+// Create the sinks enabled in config
+func InitAudit() error {
+	sinks := []AuditSink{}
+	if CONFIG.Audit.File.Enabled {
+		sink, err := NewFileAuditSink(CONFIG.Audit.File)
+		if err != nil {
+			return fmt.Errorf("cannot open audit file: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if CONFIG.Audit.Stdout.Enabled {
+		sinks = append(sinks, NewWriterAuditSink(os.Stdout))
+	}
+	if CONFIG.Audit.HTTP.Enabled {
+		sinks = append(sinks, NewHTTPAuditSink(CONFIG.Audit.HTTP))
+	}
+	SetAuditSinks(sinks...)
+	return nil
+}
+
+// Replace the sinks receiving audit records, previous sinks are not closed
+func SetAuditSinks(sinks ...AuditSink) {
+	auditSinksLock.Lock()
+	defer auditSinksLock.Unlock()
+	auditSinks = sinks
+}
+
+// Return if audit records are written to at least one sink
+func AuditEnabled() bool {
+	auditSinksLock.RLock()
+	defer auditSinksLock.RUnlock()
+	return len(auditSinks) > 0
+}
+
+// Write the record to all sinks, the timestamp is set when empty
+func WriteAudit(record AuditRecord) {
+	auditSinksLock.RLock()
+	defer auditSinksLock.RUnlock()
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+	for _, sink := range auditSinks {
+		if err := sink.Write(record); err != nil {
+			auditlog.Error(err, "cannot write audit record 😥, GomenHashai...")
+		}
+	}
+}
+
+// Close all sinks so pending records are written before GomenHashai stops
+func CloseAudit() {
+	auditSinksLock.Lock()
+	defer auditSinksLock.Unlock()
+	for _, sink := range auditSinks {
+		if err := sink.Close(); err != nil {
+			auditlog.Error(err, "cannot close audit sink 😥, GomenHashai...")
+		}
+	}
+	auditSinks = nil
+}
+
+// writerAuditSink writes one JSON record per line
+type writerAuditSink struct {
+	lock    sync.Mutex
+	writer  io.Writer
+	metric  string
+	encoder *json.Encoder
+}
+
+// Return a sink writing records to the writer, used for stdout
+func NewWriterAuditSink(writer io.Writer) AuditSink {
+	return &writerAuditSink{writer: writer, metric: auditSinkStdout, encoder: json.NewEncoder(writer)}
+}
+
+func (s *writerAuditSink) Write(record AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.encoder.Encode(record); err != nil {
+		metrics.GomenhashaiAuditDropped.WithLabelValues(s.metric).Inc()
+		return err
+	}
+	return nil
+}
+
+func (s *writerAuditSink) Close() error {
+	return nil
+}
+
+// fileAuditSink writes one JSON record per line in a file rotated when it reaches its maximum size
+type fileAuditSink struct {
+	lock   sync.Mutex
+	config AuditFileConfig
+	file   *os.File
+	size   int64
+}
+
+// Return a sink appending records to the file of the config
+func NewFileAuditSink(config AuditFileConfig) (AuditSink, error) {
+	sink := &fileAuditSink{config: config}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *fileAuditSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Rename the file to .1 after shifting previous backups and open a new file, the oldest backup is removed
+func (s *fileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.config.MaxBackups == 0 {
+		if err := os.Remove(s.config.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.config.Path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", s.config.Path, i), fmt.Sprintf("%s.%d", s.config.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.config.Path, s.config.Path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *fileAuditSink) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.size > 0 && s.size+int64(len(line)) > int64(s.config.MaxSize)*1024*1024 {
+		if err := s.rotate(); err != nil {
+			metrics.GomenhashaiAuditDropped.WithLabelValues(auditSinkFile).Inc()
+			return fmt.Errorf("cannot rotate audit file: %w", err)
+		}
+	}
+	written, err := s.file.Write(line)
+	s.size += int64(written)
+	if err != nil {
+		metrics.GomenhashaiAuditDropped.WithLabelValues(auditSinkFile).Inc()
+	}
+	return err
+}
+
+func (s *fileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+// httpAuditSink sends records in batches from a queue, failed batches are retried with a backoff
+type httpAuditSink struct {
+	config AuditHTTPConfig
+	client *http.Client
+	queue  chan AuditRecord
+	done   chan struct{}
+}
+
+// Return a sink sending records to the endpoint of the config, records are sent in background until the sink is closed
+func NewHTTPAuditSink(config AuditHTTPConfig) AuditSink {
+	sink := &httpAuditSink{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+		queue:  make(chan AuditRecord, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go sink.run()
+	return sink
+}
+
+// Record is dropped when the queue is full so admission requests are never slowed down by the endpoint
+func (s *httpAuditSink) Write(record AuditRecord) error {
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		metrics.GomenhashaiAuditDropped.WithLabelValues(auditSinkHTTP).Inc()
+		return fmt.Errorf("audit queue is full, record dropped")
+	}
+}
+
+func (s *httpAuditSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+func (s *httpAuditSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(time.Duration(s.config.FlushInterval) * time.Second)
+	defer ticker.Stop()
+	batch := make([]AuditRecord, 0, s.config.BatchSize)
+	for {
+		select {
+		case record, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= s.config.BatchSize {
+				s.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// Send the batch, retrying failed requests, and count the records of the batch as dropped if all attempts failed
+func (s *httpAuditSink) send(batch []AuditRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(batch)
+	if err == nil {
+		backoff := time.Duration(s.config.RetryInterval) * time.Second
+		for attempt := 0; attempt <= s.config.Retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+			if err = s.post(body); err == nil {
+				return
+			}
+		}
+	}
+	auditlog.Error(err, "cannot send audit records, they are dropped 😥, GomenHashai...", "url", s.config.URL, "records", len(batch))
+	metrics.GomenhashaiAuditDropped.WithLabelValues(auditSinkHTTP).Add(float64(len(batch)))
+}
+
+func (s *httpAuditSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Audit", func() {
+	record := helpers.AuditRecord{
+		Webhook:       "validation",
+		Namespace:     "default",
+		Name:          "test",
+		Container:     "app",
+		OriginalImage: "busybox:stable",
+		Verdict:       helpers.AuditVerdictDenied,
+		Mode:          helpers.ValidationModeFail,
+	}
+
+	AfterEach(func() {
+		helpers.CloseAudit()
+	})
+
+	It("should not write records without sinks", func() {
+		helpers.SetAuditSinks()
+		Expect(helpers.AuditEnabled()).To(BeFalse())
+		helpers.WriteAudit(record)
+	})
+	It("should write one JSON record per line with a timestamp", func() {
+		output := &bytes.Buffer{}
+		helpers.SetAuditSinks(helpers.NewWriterAuditSink(output))
+		helpers.WriteAudit(record)
+		helpers.WriteAudit(record)
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		written := helpers.AuditRecord{}
+		Expect(json.Unmarshal([]byte(lines[0]), &written)).To(Succeed())
+		Expect(written.Timestamp).ToNot(BeZero())
+		written.Timestamp = record.Timestamp
+		Expect(written).To(Equal(record))
+	})
+
+	Describe("File sink", func() {
+		It("should rotate the file when it reaches its maximum size", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "audit.log")
+			sink, err := helpers.NewFileAuditSink(helpers.AuditFileConfig{Enabled: true, Path: path, MaxSize: 1, MaxBackups: 1})
+			Expect(err).ToNot(HaveOccurred())
+			helpers.SetAuditSinks(sink)
+			large := record
+			large.Name = strings.Repeat("a", 600*1024)
+			for range 3 {
+				helpers.WriteAudit(large)
+			}
+			helpers.CloseAudit()
+			Expect(path).To(BeAnExistingFile())
+			Expect(path + ".1").To(BeAnExistingFile())
+			Expect(path + ".2").ToNot(BeAnExistingFile())
+			content, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(content), "\n")).To(Equal(1))
+		})
+	})
+
+	Describe("HTTP sink", func() {
+		var (
+			lock     sync.Mutex
+			batches  [][]helpers.AuditRecord
+			failures int
+			server   *httptest.Server
+		)
+
+		BeforeEach(func() {
+			batches = nil
+			failures = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+				if failures > 0 {
+					failures--
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				batch := []helpers.AuditRecord{}
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+				Expect(json.NewDecoder(r.Body).Decode(&batch)).To(Succeed())
+				batches = append(batches, batch)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		config := func() helpers.AuditHTTPConfig {
+			return helpers.AuditHTTPConfig{
+				Enabled:       true,
+				URL:           server.URL,
+				Headers:       map[string]string{"Authorization": "Bearer token"},
+				BatchSize:     2,
+				FlushInterval: 60,
+				Retries:       1,
+				RetryInterval: 1,
+				Timeout:       5,
+				QueueSize:     10,
+			}
+		}
+
+		It("should send records in batches and flush them when closed", func() {
+			helpers.SetAuditSinks(helpers.NewHTTPAuditSink(config()))
+			for range 3 {
+				helpers.WriteAudit(record)
+			}
+			helpers.CloseAudit()
+			Expect(batches).To(HaveLen(2))
+			Expect(batches[0]).To(HaveLen(2))
+			Expect(batches[1]).To(HaveLen(1))
+		})
+		It("should retry failed requests", func() {
+			failures = 1
+			helpers.SetAuditSinks(helpers.NewHTTPAuditSink(config()))
+			helpers.WriteAudit(record)
+			helpers.CloseAudit()
+			Expect(batches).To(HaveLen(1))
+			Expect(batches[0][0].Container).To(Equal("app"))
+		})
+	})
+})
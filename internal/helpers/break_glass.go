@@ -0,0 +1,90 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Annotations requesting to skip the validation of a pod until the expiry
+const (
+	BreakGlassAnnotation       = "gomenhashai.io/break-glass"
+	BreakGlassExpiryAnnotation = "gomenhashai.io/break-glass-expiry"
+)
+
+type BreakGlassConfig struct {
+	// Allow users of the groups to skip validation of pods annotated with gomenhashai.io/break-glass
+	Enabled bool `yaml:"enabled"`
+	// Groups of the users allowed to create break-glass pods
+	Groups []string `yaml:"groups" validate:"required_if=Enabled true"`
+	// Maximum time between the admission and the expiry of a break-glass pod in seconds
+	MaxDuration int `yaml:"maxDuration" validate:"gt=0"`
+	// Time between checks of expired break-glass pods to evict in seconds
+	CheckInterval int `yaml:"checkInterval" validate:"gt=0"`
+}
+
+// BreakGlass is the request of a pod to skip validation
+type BreakGlass struct {
+	Reason string
+	Expiry time.Time
+}
+
+// Return the break-glass requested by the annotations of a pod or nil, the expiry is mandatory
+func GetBreakGlass(annotations map[string]string) (*BreakGlass, error) {
+	reason, found := annotations[BreakGlassAnnotation]
+	if !found {
+		return nil, nil
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("annotation %s must give the reason of the break-glass", BreakGlassAnnotation)
+	}
+	expiry, found := annotations[BreakGlassExpiryAnnotation]
+	if !found {
+		return nil, fmt.Errorf("annotation %s is required with %s", BreakGlassExpiryAnnotation, BreakGlassAnnotation)
+	}
+	expiryTime, err := time.Parse(time.RFC3339, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("annotation %s is not a RFC3339 time: %w", BreakGlassExpiryAnnotation, err)
+	}
+	return &BreakGlass{Reason: reason, Expiry: expiryTime}, nil
+}
+
+// Return if the break-glass is expired
+func (b *BreakGlass) Expired(now time.Time) bool {
+	return !now.Before(b.Expiry)
+}
+
+// Check that a user of the groups can use the break-glass now
+func (b *BreakGlass) Authorize(groups []string, now time.Time) error {
+	if !CONFIG.BreakGlass.Enabled {
+		return fmt.Errorf("break-glass is disabled")
+	}
+	if !slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(CONFIG.BreakGlass.Groups, group) }) {
+		return fmt.Errorf("user is not in a break-glass group")
+	}
+	if b.Expired(now) {
+		return fmt.Errorf("break-glass expired at %s", b.Expiry.Format(time.RFC3339))
+	}
+	maxExpiry := now.Add(time.Duration(CONFIG.BreakGlass.MaxDuration) * time.Second)
+	if b.Expiry.After(maxExpiry) {
+		return fmt.Errorf("break-glass expiry %s is after the maximum duration of %ds", b.Expiry.Format(time.RFC3339), CONFIG.BreakGlass.MaxDuration)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Break-glass", func() {
+	var previous helpers.BreakGlassConfig
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		previous = helpers.CONFIG.BreakGlass
+		helpers.CONFIG.BreakGlass.Enabled = true
+		helpers.CONFIG.BreakGlass.Groups = []string{"oncall"}
+		helpers.CONFIG.BreakGlass.MaxDuration = 3600
+	})
+	AfterEach(func() {
+		helpers.CONFIG.BreakGlass = previous
+	})
+
+	Describe("Parse annotations", func() {
+		It("should return nil without annotation", func() {
+			breakGlass, err := helpers.GetBreakGlass(map[string]string{"app": "test"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(breakGlass).To(BeNil())
+		})
+		It("should parse the reason and expiry", func() {
+			breakGlass, err := helpers.GetBreakGlass(map[string]string{
+				helpers.BreakGlassAnnotation:       "INC-1234",
+				helpers.BreakGlassExpiryAnnotation: "2025-06-01T13:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(breakGlass.Reason).To(Equal("INC-1234"))
+			Expect(breakGlass.Expiry).To(BeTemporally("==", now.Add(time.Hour)))
+		})
+		It("should require a reason and a valid expiry", func() {
+			_, err := helpers.GetBreakGlass(map[string]string{helpers.BreakGlassAnnotation: " ", helpers.BreakGlassExpiryAnnotation: "2025-06-01T13:00:00Z"})
+			Expect(err).To(HaveOccurred())
+			_, err = helpers.GetBreakGlass(map[string]string{helpers.BreakGlassAnnotation: "INC-1234"})
+			Expect(err).To(HaveOccurred())
+			_, err = helpers.GetBreakGlass(map[string]string{helpers.BreakGlassAnnotation: "INC-1234", helpers.BreakGlassExpiryAnnotation: "tomorrow"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Authorize", func() {
+		breakGlass := &helpers.BreakGlass{Reason: "INC-1234", Expiry: now.Add(time.Hour)}
+
+		It("should allow users of the groups before the expiry", func() {
+			Expect(breakGlass.Authorize([]string{"system:authenticated", "oncall"}, now)).To(Succeed())
+		})
+		It("should reject users outside the groups", func() {
+			Expect(breakGlass.Authorize([]string{"system:authenticated"}, now)).To(MatchError(ContainSubstring("not in a break-glass group")))
+		})
+		It("should reject expired and too long break-glass", func() {
+			Expect(breakGlass.Authorize([]string{"oncall"}, now.Add(time.Hour))).To(MatchError(ContainSubstring("expired")))
+			Expect(breakGlass.Authorize([]string{"oncall"}, now.Add(-time.Minute))).To(MatchError(ContainSubstring("maximum duration")))
+		})
+		It("should reject when disabled", func() {
+			helpers.CONFIG.BreakGlass.Enabled = false
+			Expect(breakGlass.Authorize([]string{"oncall"}, now)).To(MatchError(ContainSubstring("disabled")))
+		})
+	})
+})
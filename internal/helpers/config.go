@@ -20,34 +20,72 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/go-playground/validator/v10"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
 )
 
 // Config struct
 type Config struct {
 	// Path to the digests mapping file
 	DigestsMappingFile string `yaml:"digestsMappingFile"`
+	// Watch the digests mapping file and reload it when it changes
+	DigestsMappingWatch bool `yaml:"digestsMappingWatch"`
+	// Ordered sources of trusted digests: mapping, policies, registry or signature, the first source knowing the image is used
+	TrustSources []string `yaml:"trustSources" validate:"unique,dive,oneof=mapping policies registry signature"`
 	// Config for fetching digests from registry
 	FetchDigests bool `yaml:"fetchDigests"`
+	// Use HEAD requests to fetch digests, the manifest is only downloaded to find the digest of the platform in multi-arch images
+	FetchDigestsHead bool `yaml:"fetchDigestsHead"`
+	// Platform of the digest to trust for multi-arch images ex: linux/amd64, the index digest is trusted when empty
+	FetchDigestsPlatform       string       `yaml:"fetchDigestsPlatform"`
+	FetchDigestsPlatformParsed *v1.Platform `yaml:"-" ignored:"true"`
+	// Load trusted digests from TrustedDigestPolicy resources for images not in the digests mapping
+	TrustedDigestPolicies bool `yaml:"trustedDigestPolicies"`
+	// Trust image digests signed with cosign by configured authorities
+	SignatureVerification SignatureVerificationConfig `yaml:"signatureVerification"`
 	// Auth config to pull digests from remote registry
 	RegistriesConfigFile string `yaml:"registriesConfigFile"`
-	// List of images to skip, can contain regex ex: ".*redis:.*"
-	Exemptions []string `yaml:"exemptions"`
+	// Cache of digests fetched from registry
+	RegistryCache RegistryCacheConfig `yaml:"registryCache"`
+	// List of images to skip, prefixed with exact:, regex: or glob: ex: "regex:.*redis:.*", without prefix valid images are exact and others regex
+	Exemptions       []string       `yaml:"exemptions"`
+	ExemptionsParsed []ImageMatcher `yaml:"-" ignored:"true"`
+	// List of images to skip only in ephemeral containers added with kubectl debug, same format as exemptions ex: "regex:.*" to skip all of them
+	EphemeralContainerExemptions       []string       `yaml:"ephemeralContainerExemptions"`
+	EphemeralContainerExemptionsParsed []ImageMatcher `yaml:"-" ignored:"true"`
 	// An image without tag in the mapping will be considered default. Images with tag that do not match specific trusted digest will use this digest instead (image it is the same base image)
 	ImageDefaultDigest bool `yaml:"imageDefaultDigest"`
-	// Can be warn or fail (default)
-	ValidationMode string `yaml:"validationMode" validate:"oneof=warn fail"`
+	// Digest algorithms containers can use: sha256, sha512
+	DigestAlgorithms []string `yaml:"digestAlgorithms" validate:"min=1,unique,dive,oneof=sha256 sha512"`
+	// Rules skipping containers of pods matching namespaces, service accounts, pod labels and images
+	ExemptionRules []ExemptionRule `yaml:"exemptionRules" validate:"unique=Name,dive"`
+	// Can be warn, fail (default) or audit to allow pods without warning users while recording decisions
+	ValidationMode string `yaml:"validationMode" validate:"oneof=warn fail audit"`
+	// Waves denying untrusted pods namespace by namespace from their start date, a namespace is in the first wave matching it.
+	// The validation mode of a namespace policy takes precedence over waves.
+	EnforcementWaves []EnforcementWave `yaml:"enforcementWaves" validate:"unique=Name,dive"`
+	// Policies overriding validation mode, exemptions and trusted digests for some namespaces, first matching policy is used
+	NamespacePolicies []NamespacePolicy `yaml:"namespacePolicies" validate:"dive"`
 	// Enable to not modify pods but instead logs (pods will fail validation unless you disable it or set it in warn)
 	MutationDryRun bool `yaml:"mutationDryRun"`
+	// Digest injected when an image has several trusted digests: first or newest (last in the list).
+	// Digests trusted by a namespace policy are only injected when the trust chain has none.
+	MutationDigestPreference string `yaml:"mutationDigestPreference" validate:"oneof=first newest"`
 	// Enable modifying the registry part of images with the value of MutationRegistry
 	MutationRegistryEnabled bool `yaml:"mutationRegistryEnabled"`
 	// The registry to inject when MutationRegistryEnabled is true
@@ -58,6 +96,14 @@ type Config struct {
 	MutationImagePullSecrets []corev1.LocalObjectReference `yaml:"mutationImagePullSecrets"`
 	// Configuration of the process that handles existing pods on init
 	ExistingPods ExistingPodsConfig `yaml:"existingPods"`
+	// Time-boxed skip of the validation of pods annotated by some groups of users
+	BreakGlass BreakGlassConfig `yaml:"breakGlass"`
+	// Periodic check of running pods exported as compliance metrics
+	Compliance ComplianceConfig `yaml:"compliance"`
+	// Kubernetes events emitted on pods and workloads
+	Events EventsConfig `yaml:"events"`
+	// Structured records of each decision on container images
+	Audit AuditConfig `yaml:"audit"`
 	// File containing pull secret credentials to create in all namespaces
 	PullSecretsCredentialsFile string `yaml:"pullSecretsCredentialsFile"`
 	// Namespaces to exempt from creating pull secrets
@@ -90,11 +136,32 @@ type ExistingPodsConfig struct {
 	DeleteEnabled bool `yaml:"deleteEnabled" envconfig:"EXISTING_PODS_DELETE_ENABLED"`
 }
 
+type ComplianceConfig struct {
+	// Enable the periodic check of the images of running pods against the current trust configuration
+	Enabled bool `yaml:"enabled"`
+	// Time between two checks in seconds
+	Interval int `yaml:"interval" validate:"gt=0"`
+}
+
+type RegistryCacheConfig struct {
+	// Maximum number of image references in cache, 0 disables the cache
+	Size int `yaml:"size" validate:"gte=0"`
+	// Time to keep digests fetched from registry in cache in seconds
+	TTL int `yaml:"ttl" validate:"gte=0"`
+	// Time to keep failed lookups in cache in seconds
+	NegativeTTL int `yaml:"negativeTTL" validate:"gte=0"`
+}
+
 const ValidationModeWarn = "warn"
 const ValidationModeFail = "fail"
+const ValidationModeAudit = "audit"
+
+const DigestPreferenceFirst = "first"
+const DigestPreferenceNewest = "newest"
 
 var CONFIG_PATH = "/etc/gomenhashai/configs/config.yaml"
-var DIGEST_MAPPING = map[string]string{}
+var DIGEST_MAPPING = map[string]DigestList{}
+var digestMappingLock sync.RWMutex
 var CONFIG = defaultConfig()
 var REGISTRIES_CONFIG = map[string]RegistryCredentials{}
 
@@ -108,14 +175,26 @@ type RegistryCredentials struct {
 
 func defaultConfig() Config {
 	return Config{
-		DigestsMappingFile:      "/etc/gomenhashai/digests/digests_mapping.yaml",
-		FetchDigests:            false,
-		RegistriesConfigFile:    "/etc/gomenhashai/configs/registries.yaml",
-		Exemptions:              []string{},
-		ImageDefaultDigest:      true,
-		ValidationMode:          "fail",
-		MutationDryRun:          false,
-		MutationRegistryEnabled: false,
+		DigestsMappingFile:   "/etc/gomenhashai/digests/digests_mapping.yaml",
+		DigestsMappingWatch:  true,
+		FetchDigests:         false,
+		RegistriesConfigFile: "/etc/gomenhashai/configs/registries.yaml",
+		RegistryCache: RegistryCacheConfig{
+			Size:        1000,
+			TTL:         300,
+			NegativeTTL: 30,
+		},
+		Exemptions:                   []string{},
+		EphemeralContainerExemptions: []string{},
+		ImageDefaultDigest:           true,
+		SignatureVerification: SignatureVerificationConfig{
+			CacheTTL: 300,
+		},
+		DigestAlgorithms:         []string{"sha256", "sha512"},
+		ValidationMode:           "fail",
+		MutationDryRun:           false,
+		MutationDigestPreference: DigestPreferenceFirst,
+		MutationRegistryEnabled:  false,
 		ExistingPods: ExistingPodsConfig{
 			Enabled:       true,
 			StartTimeout:  5,
@@ -124,6 +203,38 @@ func defaultConfig() Config {
 			UpdateEnabled: true,
 			DeleteEnabled: true,
 		},
+		BreakGlass: BreakGlassConfig{
+			Enabled:       false,
+			Groups:        []string{},
+			MaxDuration:   14400,
+			CheckInterval: 60,
+		},
+		Compliance: ComplianceConfig{
+			Enabled:  false,
+			Interval: 300,
+		},
+		Events: EventsConfig{
+			Enabled:           true,
+			PerMinute:         60,
+			Burst:             25,
+			DuplicateInterval: 300,
+		},
+		Audit: AuditConfig{
+			File: AuditFileConfig{
+				Enabled:    false,
+				MaxSize:    100,
+				MaxBackups: 3,
+			},
+			HTTP: AuditHTTPConfig{
+				Enabled:       false,
+				BatchSize:     100,
+				FlushInterval: 5,
+				Retries:       3,
+				RetryInterval: 1,
+				Timeout:       10,
+				QueueSize:     10000,
+			},
+		},
 		PullSecretsCredentialsFile:         "/etc/gomenhashai/configs/pullSecretsCredentials.yaml",
 		PullSecretsExemptedNamespaces:      []string{},
 		PullSecretsNamespaceSelectorLabels: labels.Everything(),
@@ -161,8 +272,48 @@ func InitConfig() error {
 		return fmt.Errorf("invalid config: %w", err)
 	}
 
+	// Prepare namespace policies label selectors
+	for i, policy := range cfg.NamespacePolicies {
+		cfg.NamespacePolicies[i].NamespaceSelectorLabels = labels.Nothing()
+		if policy.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.NamespaceSelector)
+			if err != nil {
+				return fmt.Errorf("invalid namespace selector in namespace policy %s: %w", policy.Name, err)
+			}
+			cfg.NamespacePolicies[i].NamespaceSelectorLabels = selector
+		}
+	}
+
+	// Prepare enforcement waves dates and label selectors
+	for i, wave := range cfg.EnforcementWaves {
+		if err := cfg.EnforcementWaves[i].Prepare(); err != nil {
+			return fmt.Errorf("invalid enforcement wave %s: %w", wave.Name, err)
+		}
+	}
+
+	// Prepare exemptions matchers
+	if err := cfg.PrepareExemptions(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Prepare platform of fetched digests
+	if cfg.FetchDigestsPlatform != "" {
+		platform, err := v1.ParsePlatform(cfg.FetchDigestsPlatform)
+		if err != nil {
+			return fmt.Errorf("invalid fetch digests platform: %w", err)
+		}
+		cfg.FetchDigestsPlatformParsed = platform
+	}
+
+	// Prepare signature authorities keys
+	for i, authority := range cfg.SignatureVerification.Authorities {
+		if err := cfg.SignatureVerification.Authorities[i].Prepare(); err != nil {
+			return fmt.Errorf("invalid signature authority %s: %w", authority.Name, err)
+		}
+	}
+
 	// Load registry credentials
-	if cfg.FetchDigests {
+	if cfg.UsesTrustSource(TrustSourceRegistry) || cfg.UsesTrustSource(TrustSourceSignature) {
 		if data, err := os.ReadFile(filepath.Clean(cfg.RegistriesConfigFile)); err == nil {
 			if err := yaml.Unmarshal(data, &REGISTRIES_CONFIG); err != nil {
 				return fmt.Errorf("failed to parse registries config file: %w", err)
@@ -199,20 +350,29 @@ func InitConfig() error {
 	}
 
 	CONFIG = cfg
+	ResetRegistryCache()
+	ResetSignatureCache()
 	return nil
 }
 
-// Load Digest Mapping from file
+var mappinglog = logf.Log.WithName("mapping")
+
+// Load Digest Mapping from file, the current mapping is kept if the file cannot be parsed.
+// Digests that are not valid, for instance in uppercase, are kept but never trusted so a warning is logged for each of them.
 func LoadDigestMapping() error {
 
 	mappingPath := CONFIG.DigestsMappingFile
 
 	data, err := os.ReadFile(filepath.Clean(mappingPath))
 	if err == nil {
-		if err := yaml.Unmarshal(data, &DIGEST_MAPPING); err != nil {
+		mapping := map[string]DigestList{}
+		if err := yaml.Unmarshal(data, &mapping); err != nil {
 			return err
 		}
-
+		for _, err := range ValidateDigestMapping(mapping) {
+			mappinglog.Info("[🍣GomenHashai!] digest of the mapping is ignored, images using it will not be trusted ⚠️", "reason", err.Error())
+		}
+		SetDigestMapping(mapping)
 	} else if !os.IsNotExist(err) {
 		return err
 	}
@@ -220,6 +380,34 @@ func LoadDigestMapping() error {
 	return nil
 }
 
+// Return an error for each digest of the mapping that is not valid, with the image it is mapped to
+func ValidateDigestMapping(mapping map[string]DigestList) []error {
+	var errs []error
+	for _, image := range slices.Sorted(maps.Keys(mapping)) {
+		for _, digest := range mapping[image] {
+			if _, _, err := ParseDigest(digest); err != nil {
+				errs = append(errs, fmt.Errorf("image %s: %w", image, err))
+			}
+		}
+	}
+	return errs
+}
+
+// Replace the digest mapping in use, the map must not be modified afterwards
+func SetDigestMapping(mapping map[string]DigestList) {
+	digestMappingLock.Lock()
+	defer digestMappingLock.Unlock()
+	DIGEST_MAPPING = mapping
+	metrics.GomenhashaiMappingEntries.Set(float64(len(mapping)))
+}
+
+// Return the digest mapping in use, the map must not be modified
+func GetDigestMapping() map[string]DigestList {
+	digestMappingLock.RLock()
+	defer digestMappingLock.RUnlock()
+	return DIGEST_MAPPING
+}
+
 func MakeDockerConfigJson(username, token, registry string) ([]byte, error) {
 	// Build .dockerconfigjson content
 	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, token)))
@@ -0,0 +1,126 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+var _ = Describe("Config", func() {
+	var previousMapping map[string]helpers.DigestList
+	var previousMappingFile string
+	var mappingFile string
+
+	BeforeEach(func() {
+		previousMapping = helpers.GetDigestMapping()
+		previousMappingFile = helpers.CONFIG.DigestsMappingFile
+		mappingFile = filepath.Join(GinkgoT().TempDir(), "digests_mapping.yaml")
+		helpers.CONFIG.DigestsMappingFile = mappingFile
+	})
+
+	AfterEach(func() {
+		helpers.SetDigestMapping(previousMapping)
+		helpers.CONFIG.DigestsMappingFile = previousMappingFile
+	})
+
+	// Test LoadDigestMapping()
+	Describe("Load digests mapping", func() {
+		Context("with valid file", func() {
+			It("should replace the mapping", func() {
+				Expect(os.WriteFile(mappingFile, []byte(`"alpine:3": "sha256:aaaa"`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(helpers.GetDigestMapping()).To(Equal(map[string]helpers.DigestList{"alpine:3": {"sha256:aaaa"}}))
+			})
+		})
+		Context("with list of digests", func() {
+			It("should accept single digests and lists", func() {
+				Expect(os.WriteFile(mappingFile, []byte(`
+"alpine:3": "sha256:aaaa"
+"alpine:4":
+  - "sha256:bbbb"
+  - "sha256:cccc"
+`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(helpers.GetDigestMapping()).To(Equal(map[string]helpers.DigestList{
+					"alpine:3": {"sha256:aaaa"},
+					"alpine:4": {"sha256:bbbb", "sha256:cccc"},
+				}))
+			})
+		})
+		Context("with updated file", func() {
+			It("should drop removed entries", func() {
+				Expect(os.WriteFile(mappingFile, []byte(`"alpine:3": "sha256:aaaa"`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(os.WriteFile(mappingFile, []byte(`"alpine:4": "sha256:bbbb"`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(helpers.GetDigestMapping()).To(Equal(map[string]helpers.DigestList{"alpine:4": {"sha256:bbbb"}}))
+			})
+			It("should report the number of entries", func() {
+				Expect(os.WriteFile(mappingFile, []byte(`
+"alpine:3": "sha256:aaaa"
+"alpine:4": "sha256:bbbb"
+`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				metric := &dto.Metric{}
+				Expect(metrics.GomenhashaiMappingEntries.Write(metric)).To(Succeed())
+				Expect(metric.GetGauge().GetValue()).To(BeEquivalentTo(2))
+			})
+		})
+		Context("with invalid file", func() {
+			It("should fail and keep previous mapping", func() {
+				Expect(os.WriteFile(mappingFile, []byte(`"alpine:3": "sha256:aaaa"`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(os.WriteFile(mappingFile, []byte(`"alpine:3": [unclosed`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).ToNot(Succeed())
+				Expect(helpers.GetDigestMapping()).To(Equal(map[string]helpers.DigestList{"alpine:3": {"sha256:aaaa"}}))
+			})
+		})
+		Context("with invalid digests", func() {
+			It("should keep the mapping and report each invalid digest with its image", func() {
+				upper := "sha256:E246AA22AD2CBDFBD19E2A6CA2B275E26245A21920E2B2D0666324CEE3F15549"
+				valid := "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"
+				Expect(os.WriteFile(mappingFile, []byte(`
+"alpine:3": "`+upper+`"
+"alpine:4":
+  - "`+valid+`"
+  - "sha256:bbbb"
+`), 0600)).To(Succeed())
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(helpers.GetDigestMapping()).To(HaveLen(2))
+				errs := helpers.ValidateDigestMapping(helpers.GetDigestMapping())
+				Expect(errs).To(HaveLen(2))
+				Expect(errs[0]).To(MatchError(ContainSubstring("image alpine:3: sha256 digest must be 64 lowercase hex characters")))
+				Expect(errs[1]).To(MatchError(ContainSubstring("image alpine:4")))
+			})
+		})
+		Context("without file", func() {
+			It("should keep previous mapping", func() {
+				helpers.SetDigestMapping(map[string]helpers.DigestList{"alpine:3": {"sha256:aaaa"}})
+				Expect(helpers.LoadDigestMapping()).To(Succeed())
+				Expect(helpers.GetDigestMapping()).To(Equal(map[string]helpers.DigestList{"alpine:3": {"sha256:aaaa"}}))
+			})
+		})
+	})
+})
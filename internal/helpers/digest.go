@@ -17,55 +17,288 @@ limitations under the License.
 package helpers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"path"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
 )
 
 const DEFAULT_DIGEST_MAPPING_PATH = "/etc/gomenhashai/digests_mapping.yaml"
 
+// Implicit parts of image references
+const (
+	defaultRegistry  = "docker.io"
+	defaultNamespace = "library/"
+	defaultTag       = "latest"
+)
+
+// DigestList is a list of trusted digests ordered from oldest to newest, a single digest is accepted in YAML
+type DigestList []string
+
+func (l *DigestList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = DigestList{value.Value}
+		return nil
+	}
+	var digests []string
+	if err := value.Decode(&digests); err != nil {
+		return err
+	}
+	*l = digests
+	return nil
+}
+
+// Digest algorithms registered in the OCI image spec and the length of their hex encoded part
+var digestAlgorithms = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// Digest grammar of the OCI image spec: algorithm ":" encoded
+var imageDigestRegexp = regexp.MustCompile(`@([a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]+)$`)
+var digestRegexp = regexp.MustCompile(`^([a-z0-9]+(?:[+._-][a-z0-9]+)*):([a-zA-Z0-9=_-]+)$`)
+var hexRegexp = regexp.MustCompile(`^[a-f0-9]+$`)
+
 // getDigest from container image or return empty, invalid digests are ignored
 func GetDigest(image string) string {
-	re := regexp.MustCompile(`@sha256:[a-fA-F0-9]{64}$`)
-	match := re.FindString(image)
-	if match != "" {
-		return match[1:]
+	_, digest := SplitImageDigest(image)
+	if IsValidDigest(digest) {
+		return digest
 	}
 	return ""
 }
 
-// Return trusted digests from file or registry depending on conf
+// Return the image without digest and the digest following the OCI digest grammar, even if its algorithm is not supported
+func SplitImageDigest(image string) (string, string) {
+	match := imageDigestRegexp.FindStringSubmatch(image)
+	if match == nil {
+		return image, ""
+	}
+	return strings.TrimSuffix(image, match[0]), match[1]
+}
+
+// Return an error if the digest does not follow the OCI digest grammar or does not use a registered algorithm
+func ParseDigest(digest string) (string, string, error) {
+	match := digestRegexp.FindStringSubmatch(digest)
+	if match == nil {
+		return "", "", fmt.Errorf("digest %q does not follow the algorithm:encoded format", digest)
+	}
+	algorithm, encoded := match[1], match[2]
+	length, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return "", "", fmt.Errorf("digest algorithm %q is not supported", algorithm)
+	}
+	if len(encoded) != length || !hexRegexp.MatchString(encoded) {
+		return "", "", fmt.Errorf("%s digest must be %d lowercase hex characters", algorithm, length)
+	}
+	return algorithm, encoded, nil
+}
+
+// Return if the value is a digest that can be used in an image reference
+func IsValidDigest(digest string) bool {
+	_, _, err := ParseDigest(digest)
+	return err == nil
+}
+
+// Return an error if the digest is not valid or its algorithm is not in the digestAlgorithms allowlist
+func ValidateDigest(digest string) error {
+	algorithm, _, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(CONFIG.DigestAlgorithms, algorithm) {
+		return fmt.Errorf("digest algorithm %q is not allowed", algorithm)
+	}
+	return nil
+}
+
+// Return the preferred trusted digest of the first source of the trust chain that knows the image
 func GetTrustedDigest(image string) (string, error) {
-	if CONFIG.FetchDigests {
-		return GetDigestFromRegistry(image)
-	} else {
-		return GetTrustedDigestFromMapping(image), nil
+	digests, err := GetTrustedDigests(image)
+	return PreferredDigest(digests), err
+}
+
+// Return the digest to inject from trusted digests depending on conf or empty string, digests with an algorithm not allowed are skipped
+func PreferredDigest(digests []string) string {
+	allowed := slices.DeleteFunc(slices.Clone(digests), func(digest string) bool {
+		return ValidateDigest(digest) != nil
+	})
+	if len(allowed) == 0 {
+		return ""
+	}
+	if CONFIG.MutationDigestPreference == DigestPreferenceNewest {
+		return allowed[len(allowed)-1]
 	}
+	return allowed[0]
 }
 
-// Return digest from mapping for this image or empty string
+// Return trusted digests of the first source of the trust chain that knows the image
+func GetTrustedDigests(image string) ([]string, error) {
+	digests, _, err := ResolveTrustedDigests(image, "")
+	return digests, err
+}
+
+// Return preferred digest from mapping for this image or empty string
 func GetTrustedDigestFromMapping(image string) string {
-	if digest, ok := DIGEST_MAPPING[image]; ok {
-		return digest
-	} else {
-		// Check for base image without tag in mapping this will be default
-		if CONFIG.ImageDefaultDigest && strings.Contains(image, ":") {
-			imageWithoutTag := strings.Split(image, ":")[0]
-			if digest, ok := DIGEST_MAPPING[imageWithoutTag]; ok {
-				return digest
+	return PreferredDigest(GetTrustedDigestsFromMapping(image))
+}
+
+// Return digests from mapping for this image or empty list
+func GetTrustedDigestsFromMapping(image string) []string {
+	digests, _ := lookupMapping(GetDigestMapping(), image)
+	return digests
+}
+
+// Label of images not in the mapping in metrics
+const UnmappedImageLabel = "unmapped"
+
+// Return the image label of metrics: the mapping key of the image, images not in the mapping share the same label to bound cardinality
+func ImageMetricLabel(image string) string {
+	image, _ = SplitImageDigest(image)
+	if _, key, ok := lookupMappingKey(GetDigestMapping(), image); ok {
+		return key
+	}
+	return UnmappedImageLabel
+}
+
+// Find the value of this image in a mapping using image names as keys.
+// Keys match all the spellings of the same reference: docker.io is the implicit registry, library/ the implicit
+// namespace of docker.io and latest the implicit tag, so nginx, docker.io/library/nginx and index.docker.io/library/nginx:latest are equivalent.
+// Keys with a registry take precedence over keys without registry, which match images of any registry.
+// For each of them the key with the tag of the image takes precedence over the key without tag, used for all tags if imageDefaultDigest is enabled.
+// Keys with glob patterns are used last, the longest matching key wins.
+func lookupMapping[T any](mapping map[string]T, image string) (T, bool) {
+	value, _, ok := lookupMappingKey(mapping, image)
+	return value, ok
+}
+
+// Find the value and the key of this image in a mapping, see lookupMapping
+func lookupMappingKey[T any](mapping map[string]T, image string) (T, string, bool) {
+	var empty T
+	tag, err := parseImageTag(image)
+	if err != nil {
+		value, ok := mapping[image]
+		return value, image, ok
+	}
+	registry := normalizeRegistry(tag.RegistryStr())
+	repositories := repositorySpellings(tag.RepositoryStr())
+
+	registrySpellings := []string{}
+	registries := []string{registry}
+	if registry == defaultRegistry {
+		registries = append(registries, name.DefaultRegistry)
+	}
+	for _, registry := range registries {
+		for _, repository := range repositories {
+			registrySpellings = append(registrySpellings, registry+"/"+repository)
+		}
+	}
+	for _, spellings := range [][]string{registrySpellings, repositories} {
+		if value, key, ok := lookupRepository(mapping, spellings, tag.TagStr()); ok {
+			return value, key, true
+		}
+	}
+	if value, key, ok := lookupGlob(mapping, append(registrySpellings, repositories...), tag.TagStr()); ok {
+		return value, key, true
+	}
+	return empty, "", false
+}
+
+// Find the value of the longest glob key matching a spelling of the repository with the tag, or without tag if it is used as default.
+// Globs use path.Match syntax so * does not match /, keys of the same length are compared alphabetically to stay deterministic.
+func lookupGlob[T any](mapping map[string]T, spellings []string, tag string) (T, string, bool) {
+	var value T
+	best := ""
+	for key, candidate := range mapping {
+		if !isGlob(key) || !matchGlob(key, spellings, tag) {
+			continue
+		}
+		if best == "" || len(key) > len(best) || (len(key) == len(best) && key < best) {
+			best = key
+			value = candidate
+		}
+	}
+	return value, best, best != ""
+}
+
+func matchGlob(pattern string, spellings []string, tag string) bool {
+	for _, repository := range spellings {
+		if match, _ := path.Match(pattern, repository+":"+tag); match {
+			return true
+		}
+		if CONFIG.ImageDefaultDigest || tag == defaultTag {
+			if match, _ := path.Match(pattern, repository); match {
+				return true
 			}
 		}
-		// Try to find digest without registry part if it exist
-		imageWithoutRegistry := GetImageWithoutRegistry(image)
-		if imageWithoutRegistry != image {
-			return GetTrustedDigestFromMapping(imageWithoutRegistry)
+	}
+	return false
+}
+
+// Return if the mapping key is a glob pattern
+func isGlob(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// Find the value of the first spelling of the repository with the tag, or without tag if it is used as default
+func lookupRepository[T any](mapping map[string]T, spellings []string, tag string) (T, string, bool) {
+	for _, repository := range spellings {
+		if value, ok := mapping[repository+":"+tag]; ok {
+			return value, repository + ":" + tag, true
 		}
 	}
-	return ""
+	if CONFIG.ImageDefaultDigest || tag == defaultTag {
+		for _, repository := range spellings {
+			if value, ok := mapping[repository]; ok {
+				return value, repository, true
+			}
+		}
+	}
+	var empty T
+	return empty, "", false
+}
+
+// Return the spellings of a repository path without registry, library/ is implicit for single component paths
+func repositorySpellings(repository string) []string {
+	if short, ok := strings.CutPrefix(repository, defaultNamespace); ok && !strings.Contains(short, "/") {
+		return []string{repository, short}
+	}
+	if !strings.Contains(repository, "/") {
+		return []string{defaultNamespace + repository, repository}
+	}
+	return []string{repository}
+}
+
+// Parse an image reference with a tag, references using a digest are rejected
+func parseImageTag(image string) (name.Tag, error) {
+	if strings.Contains(image, "@") {
+		return name.Tag{}, fmt.Errorf("image reference %q uses a digest", image)
+	}
+	return name.NewTag(image, name.WeakValidation)
+}
+
+// Return the canonical form of the image with explicit registry, repository and tag:
+// nginx becomes docker.io/library/nginx:latest and localhost:5000/app becomes localhost:5000/app:latest.
+// The image is returned unchanged if it is not a valid reference or uses a digest.
+func CanonicalImage(image string) string {
+	tag, err := parseImageTag(image)
+	if err != nil {
+		return image
+	}
+	return normalizeRegistry(tag.RegistryStr()) + "/" + tag.RepositoryStr() + ":" + tag.TagStr()
 }
 
 // Return digest from registry for this image or empty string
@@ -75,66 +308,115 @@ func GetDigestFromRegistry(image string) (string, error) {
 		return "", fmt.Errorf("failed to parse image reference: %v", err)
 	}
 
-	registry := ref.Context().RegistryStr()
+	return cachedRegistryLookup(ref.Name(), func() (string, error) {
+		registry := registryMetricLabel(ref.Context().RegistryStr())
+		timer := prometheus.NewTimer(metrics.GomenhashaiRegistryLookupDuration.WithLabelValues(registry))
+		digest, err := fetchDigest(ref)
+		timer.ObserveDuration()
+		if err != nil {
+			metrics.GomenhashaiRegistryErrors.WithLabelValues(registry, registryErrorStatus(err)).Inc()
+		}
+		return digest, err
+	})
+}
+
+// Label of registries without credentials in metrics
+const otherRegistryLabel = "other"
+
+// Return the registry label of metrics, only docker.io, the mutation registry and registries with credentials are named to bound cardinality
+func registryMetricLabel(registry string) string {
 	registry = normalizeRegistry(registry)
+	if _, ok := REGISTRIES_CONFIG[registry]; ok || registry == defaultRegistry || registry == CONFIG.MutationRegistry {
+		return registry
+	}
+	return otherRegistryLabel
+}
+
+// Return the HTTP status class of a registry error: 4xx, 5xx or other when the registry did not answer with an error status
+func registryErrorStatus(err error) string {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) && transportErr.StatusCode >= 400 && transportErr.StatusCode < 600 {
+		return fmt.Sprintf("%dxx", transportErr.StatusCode/100)
+	}
+	return "other"
+}
+
+// Fetch the digest of the reference, or of the manifest matching the configured platform for multi-arch images
+func fetchDigest(ref name.Reference) (string, error) {
+	options := registryOptions(ref.Context().RegistryStr())
+	platform := CONFIG.FetchDigestsPlatformParsed
+
+	if CONFIG.FetchDigestsHead {
+		// Registries not answering HEAD requests properly are queried with GET
+		desc, err := remote.Head(ref, options...)
+		if err == nil && (platform == nil || !desc.MediaType.IsIndex()) {
+			return desc.Digest.String(), nil
+		}
+	}
+
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to get image from registry: %w", err)
+	}
+	if platform == nil || !desc.MediaType.IsIndex() {
+		return desc.Digest.String(), nil
+	}
+
+	index, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image index: %v", err)
+	}
+	for _, manifest := range index.Manifests {
+		if manifest.Platform != nil && manifest.Platform.Satisfies(*platform) {
+			return manifest.Digest.String(), nil
+		}
+	}
+	return "", fmt.Errorf("image index has no manifest for platform %s", platform)
+}
 
-	var options []remote.Option
+// Return the options to authenticate to the registry
+func registryOptions(registry string) []remote.Option {
+	registry = normalizeRegistry(registry)
 
 	authCreds, ok := REGISTRIES_CONFIG[registry]
 	if ok {
-		options = []remote.Option{
+		return []remote.Option{
 			remote.WithAuth(&authn.Basic{
 				Username: authCreds.Username,
 				Password: authCreds.Password,
 			}),
 		}
-	} else {
-		// Use DefaultKeychain
-		options = []remote.Option{
-			remote.WithAuthFromKeychain(authn.DefaultKeychain),
-		}
 	}
-
-	desc, err := remote.Get(ref, options...)
-	if err != nil {
-		return "", fmt.Errorf("failed to get image from registry: %v", err)
+	// Use DefaultKeychain
+	return []remote.Option{
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
 	}
-
-	return desc.Digest.String(), nil
 }
 
 func normalizeRegistry(reg string) string {
 	// Handle common aliases
-	if reg == "index.docker.io" {
-		return "docker.io"
+	if reg == name.DefaultRegistry {
+		return defaultRegistry
 	}
 	return reg
 }
 
 // Return image without registry part if present at the beginning of image
 func GetImageWithoutRegistry(image string) string {
-	if strings.Contains(strings.Split(image, "/")[0], ".") {
-		imageWithoutRegistry := strings.Join(strings.Split(image, "/")[1:], "/")
+	registry, imageWithoutRegistry, found := strings.Cut(image, "/")
+	// Like docker, the first component is a registry if it contains a dot or a port or is localhost
+	if found && (strings.ContainsAny(registry, ".:") || registry == "localhost") {
 		return imageWithoutRegistry
 	}
 	return image
 }
 
-// Return if the image match an entry in the exempt list which can contain regex
+// Return if the image match an entry in the exempt list
 func IsImageExempt(image string) bool {
-	if len(CONFIG.Exemptions) > 0 {
-		for _, exemption := range CONFIG.Exemptions {
-			if image == exemption {
-				return true
-			}
-			re, err := regexp.Compile(exemption)
-			if err == nil {
-				match := re.FindString(image)
-				if match != "" {
-					return true
-				}
-			}
-		}
-	}
-	return false
+	return matchExemptions(CONFIG.ExemptionsParsed, exemptionListGlobal, image)
+}
+
+// Return if the image of an ephemeral container match an entry in the exempt list or the ephemeral containers exempt list
+func IsEphemeralImageExempt(image string) bool {
+	return IsImageExempt(image) || matchExemptions(CONFIG.EphemeralContainerExemptionsParsed, exemptionListEphemeral, image)
 }
@@ -17,6 +17,21 @@ limitations under the License.
 package helpers_test
 
 import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -36,15 +51,15 @@ var _ = Describe("Digest", func() {
 	var imageNoDigest string
 	var goodDigestBusybox string
 
-	helpers.DIGEST_MAPPING = map[string]string{
-		"busybox:latest":                   "sha256:37f7b378a29ceb4c551b1b5582e27747b855bbfaa73fa11914fe0df028dc581f",
-		"busybox":                          "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549",
-		"library/busybox":                  "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549",
-		"docker.io/library/busybox":        "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549",
-		"docker.io/library/busybox:stable": "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549",
-		"busybox:stable":                   "sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549",
-		"nginx/nginx-ingress:5.0.0-alpine": "sha256:a6c4d7c7270f03a3abb1ff38973f5db98d8660832364561990c4d0ef8b1477af",
-		"curlimages/curl:8.13.0":           "sha256:d56bdb28bae0be0998f3be83199bfb2b81e0a30b034b6d7586ce7e05de34c3fd", // Not the right digest in docker registry in order to verify that pull mode actually pull right digest
+	helpers.DIGEST_MAPPING = map[string]helpers.DigestList{
+		"busybox:latest":                   {"sha256:37f7b378a29ceb4c551b1b5582e27747b855bbfaa73fa11914fe0df028dc581f"},
+		"busybox":                          {"sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"},
+		"library/busybox":                  {"sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"},
+		"docker.io/library/busybox":        {"sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"},
+		"docker.io/library/busybox:stable": {"sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"},
+		"busybox:stable":                   {"sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549"},
+		"nginx/nginx-ingress:5.0.0-alpine": {"sha256:a6c4d7c7270f03a3abb1ff38973f5db98d8660832364561990c4d0ef8b1477af"},
+		"curlimages/curl:8.13.0":           {"sha256:d56bdb28bae0be0998f3be83199bfb2b81e0a30b034b6d7586ce7e05de34c3fd"}, // Not the right digest in docker registry in order to verify that pull mode actually pull right digest
 	}
 
 	BeforeEach(func() {
@@ -59,6 +74,7 @@ var _ = Describe("Digest", func() {
 		invalidDigest = "sh56:aae246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e"
 		imageInvalidDigest = "docker.io/library/busybox" + "@" + invalidDigest
 		goodDigestBusybox = "sha256:98ad9d1a2be345201bb0709b0d38655eb1b370145c7d94ca1fe9c421f76e245a"
+		helpers.ResetRegistryCache()
 	})
 
 	// Test GetDigest()
@@ -85,13 +101,54 @@ var _ = Describe("Digest", func() {
 		})
 	})
 
+	// Test ParseDigest() and ValidateDigest()
+	Describe("Digest grammar", func() {
+		sha512Digest := "sha512:" + strings.Repeat("ab", 64)
+		AfterEach(func() {
+			helpers.CONFIG.DigestAlgorithms = []string{"sha256", "sha512"}
+		})
+		It("should extract sha512 digests", func() {
+			Expect(helpers.GetDigest("busybox:1@" + sha512Digest)).To(Equal(sha512Digest))
+			image, imageDigest := helpers.SplitImageDigest("localhost:5000/busybox:1@" + sha512Digest)
+			Expect(image).To(Equal("localhost:5000/busybox:1"))
+			Expect(imageDigest).To(Equal(sha512Digest))
+		})
+		It("should split digests with an unknown algorithm but ignore them", func() {
+			image, imageDigest := helpers.SplitImageDigest("busybox@md5:abcd")
+			Expect(image).To(Equal("busybox"))
+			Expect(imageDigest).To(Equal("md5:abcd"))
+			Expect(helpers.GetDigest("busybox@md5:abcd")).To(BeEmpty())
+		})
+		It("should validate the algorithm and encoded length", func() {
+			_, _, err := helpers.ParseDigest("md5:abcd")
+			Expect(err).To(MatchError(ContainSubstring("not supported")))
+			_, _, err = helpers.ParseDigest("sha512:" + strings.Repeat("ab", 32))
+			Expect(err).To(MatchError(ContainSubstring("128 lowercase hex")))
+			_, _, err = helpers.ParseDigest("sha256:" + strings.Repeat("AB", 32))
+			Expect(err).To(HaveOccurred())
+			_, _, err = helpers.ParseDigest("sha256")
+			Expect(err).To(MatchError(ContainSubstring("algorithm:encoded")))
+			algorithm, encoded, err := helpers.ParseDigest(sha512Digest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(algorithm).To(Equal("sha512"))
+			Expect(encoded).To(HaveLen(128))
+		})
+		It("should only accept allowed algorithms", func() {
+			Expect(helpers.ValidateDigest(sha512Digest)).To(Succeed())
+			helpers.CONFIG.DigestAlgorithms = []string{"sha256"}
+			Expect(helpers.ValidateDigest(sha512Digest)).To(MatchError(ContainSubstring("not allowed")))
+			Expect(helpers.ValidateDigest(digest)).To(Succeed())
+			Expect(helpers.PreferredDigest([]string{sha512Digest, digest})).To(Equal(digest))
+		})
+	})
+
 	// Test GetTrustedDigest()
 	Describe("Get trusted digest", func() {
 		Context("with default config and trusted tag", func() {
 			It("should be digest from mapping", func() {
 				localDigest, err := helpers.GetTrustedDigest(imageWithTrustedTag)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(localDigest).To(Equal(helpers.DIGEST_MAPPING[imageWithTrustedTag]))
+				Expect(localDigest).To(Equal(helpers.DIGEST_MAPPING[imageWithTrustedTag][0]))
 			})
 		})
 		Context("with fetch registry and tag", func() {
@@ -136,12 +193,35 @@ var _ = Describe("Digest", func() {
 		})
 		Context("with trusted tag", func() {
 			It("should be digest from mapping", func() {
-				Expect(helpers.GetTrustedDigestFromMapping(imageWithTrustedTag)).To(Equal(helpers.DIGEST_MAPPING[imageWithTrustedTag]))
+				Expect(helpers.GetTrustedDigestFromMapping(imageWithTrustedTag)).To(Equal(helpers.DIGEST_MAPPING[imageWithTrustedTag][0]))
 			})
 		})
 		Context("without tag", func() {
 			It("should be digest from mapping", func() {
-				Expect(helpers.GetTrustedDigestFromMapping(baseImage)).To(Equal(helpers.DIGEST_MAPPING[baseImage]))
+				Expect(helpers.GetTrustedDigestFromMapping(baseImage)).To(Equal(helpers.DIGEST_MAPPING[baseImage][0]))
+			})
+		})
+	})
+
+	// Test PreferredDigest()
+	Describe("Preferred digest", func() {
+		AfterEach(func() {
+			helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceFirst
+		})
+		Context("with first preference", func() {
+			It("should be the first digest", func() {
+				Expect(helpers.PreferredDigest([]string{"sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"})).To(Equal("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+			})
+		})
+		Context("with newest preference", func() {
+			It("should be the last digest", func() {
+				helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceNewest
+				Expect(helpers.PreferredDigest([]string{"sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"})).To(Equal("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"))
+			})
+		})
+		Context("without digest", func() {
+			It("should be empty", func() {
+				Expect(helpers.PreferredDigest(nil)).To(BeEmpty())
 			})
 		})
 	})
@@ -262,4 +342,244 @@ var _ = Describe("Digest", func() {
 			})
 		})
 	})
+
+	// Test IsEphemeralImageExempt()
+	Describe("Is the ephemeral container image exempted", func() {
+		BeforeEach(func() {
+			helpers.CONFIG.EphemeralContainerExemptions = []string{"curlimages/.*"}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+		})
+		AfterEach(func() {
+			helpers.CONFIG.EphemeralContainerExemptions = []string{}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+		})
+		It("should be exempted by ephemeral exemptions", func() {
+			Expect(helpers.IsEphemeralImageExempt(imageWithTrustedTag)).To(BeTrue())
+			Expect(helpers.IsImageExempt(imageWithTrustedTag)).To(BeFalse())
+		})
+		It("should be exempted by global exemptions", func() {
+			Expect(helpers.IsEphemeralImageExempt("lib/redis:6")).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Canonical image reference", func() {
+	var mapping map[string]helpers.DigestList
+
+	BeforeEach(func() {
+		mapping = helpers.DIGEST_MAPPING
+		helpers.DIGEST_MAPPING = map[string]helpers.DigestList{
+			"nginx:1.27":                    {"sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+			"docker.io/library/alpine":      {"sha256:2222222222222222222222222222222222222222222222222222222222222222"},
+			"localhost:5000/team/app:1":     {"sha256:3333333333333333333333333333333333333333333333333333333333333333"},
+			"team/app:2":                    {"sha256:4444444444444444444444444444444444444444444444444444444444444444"},
+			"quay.io/team/tool":             {"sha256:5555555555555555555555555555555555555555555555555555555555555555"},
+			"team/tool:1":                   {"sha256:6666666666666666666666666666666666666666666666666666666666666666"},
+			"index.docker.io/library/redis": {"sha256:7777777777777777777777777777777777777777777777777777777777777777"},
+		}
+	})
+	AfterEach(func() {
+		helpers.DIGEST_MAPPING = mapping
+		helpers.CONFIG.ImageDefaultDigest = true
+	})
+
+	It("should make registry, repository and tag explicit", func() {
+		Expect(helpers.CanonicalImage("nginx")).To(Equal("docker.io/library/nginx:latest"))
+		Expect(helpers.CanonicalImage("index.docker.io/library/nginx:1")).To(Equal("docker.io/library/nginx:1"))
+		Expect(helpers.CanonicalImage("docker.io/team/app")).To(Equal("docker.io/team/app:latest"))
+		Expect(helpers.CanonicalImage("localhost:5000/app:1")).To(Equal("localhost:5000/app:1"))
+		Expect(helpers.CanonicalImage("nginx@sha256:1111111111111111111111111111111111111111111111111111111111111111")).To(Equal("nginx@sha256:1111111111111111111111111111111111111111111111111111111111111111"))
+	})
+	It("should match all spellings of docker.io images with one entry", func() {
+		for _, image := range []string{"nginx:1.27", "library/nginx:1.27", "docker.io/library/nginx:1.27", "index.docker.io/nginx:1.27"} {
+			Expect(helpers.GetTrustedDigestFromMapping(image)).To(Equal(helpers.DIGEST_MAPPING["nginx:1.27"][0]), image)
+		}
+	})
+	It("should use latest as implicit tag", func() {
+		helpers.CONFIG.ImageDefaultDigest = false
+		for _, image := range []string{"alpine", "alpine:latest", "index.docker.io/library/alpine:latest"} {
+			Expect(helpers.GetTrustedDigestFromMapping(image)).To(Equal(helpers.DIGEST_MAPPING["docker.io/library/alpine"][0]), image)
+		}
+		Expect(helpers.GetTrustedDigestFromMapping("redis")).To(Equal(helpers.DIGEST_MAPPING["index.docker.io/library/redis"][0]))
+		Expect(helpers.GetTrustedDigestFromMapping("alpine:3")).To(BeEmpty())
+	})
+	It("should not split registries with port at the port", func() {
+		Expect(helpers.GetTrustedDigestFromMapping("localhost:5000/team/app:1")).To(Equal(helpers.DIGEST_MAPPING["localhost:5000/team/app:1"][0]))
+		Expect(helpers.GetTrustedDigestFromMapping("localhost:5000/team/app:2")).To(Equal(helpers.DIGEST_MAPPING["team/app:2"][0]))
+		Expect(helpers.GetTrustedDigestFromMapping("localhost:5001/team/app:1")).To(BeEmpty())
+		Expect(helpers.GetImageWithoutRegistry("localhost:5000/team/app:1")).To(Equal("team/app:1"))
+		Expect(helpers.GetImageWithoutRegistry("localhost/team/app:1")).To(Equal("team/app:1"))
+	})
+	It("should not match entries with a registry for images of another registry", func() {
+		Expect(helpers.GetTrustedDigestFromMapping("ghcr.io/library/alpine")).To(BeEmpty())
+		Expect(helpers.GetTrustedDigestFromMapping("ghcr.io/nginx:1.27")).To(Equal(helpers.DIGEST_MAPPING["nginx:1.27"][0]))
+	})
+	It("should label metrics with the mapping key and bucket other images", func() {
+		Expect(helpers.ImageMetricLabel("index.docker.io/library/nginx:1.27@sha256:1111111111111111111111111111111111111111111111111111111111111111")).To(Equal("nginx:1.27"))
+		Expect(helpers.ImageMetricLabel("quay.io/team/tool:9")).To(Equal("quay.io/team/tool"))
+		Expect(helpers.ImageMetricLabel("ghcr.io/someone/random:1")).To(Equal(helpers.UnmappedImageLabel))
+		Expect(helpers.ImageMetricLabel("ghcr.io/someone/other:2")).To(Equal(helpers.UnmappedImageLabel))
+	})
+	It("should prefer entries with a registry over entries without registry", func() {
+		Expect(helpers.GetTrustedDigestFromMapping("quay.io/team/tool:1")).To(Equal(helpers.DIGEST_MAPPING["quay.io/team/tool"][0]))
+		Expect(helpers.GetTrustedDigestFromMapping("team/tool:1")).To(Equal(helpers.DIGEST_MAPPING["team/tool:1"][0]))
+	})
+})
+
+var _ = Describe("Glob keys in mapping", func() {
+	var mapping map[string]helpers.DigestList
+	digests := map[string]string{}
+	keys := []string{
+		"busybox:1.36.1",
+		"busybox",
+		"*/library/busybox:1.36*",
+		"*/library/busybox:*",
+		"registry.corp/*/base:*",
+		"registry.corp/*/base:1.*",
+		"registry.corp/team/base:1",
+		"tools/*",
+	}
+
+	BeforeEach(func() {
+		mapping = helpers.DIGEST_MAPPING
+		helpers.DIGEST_MAPPING = map[string]helpers.DigestList{}
+		for i, key := range keys {
+			digests[key] = fmt.Sprintf("sha256:%064d", i)
+			helpers.DIGEST_MAPPING[key] = helpers.DigestList{digests[key]}
+		}
+	})
+	AfterEach(func() {
+		helpers.DIGEST_MAPPING = mapping
+		helpers.CONFIG.ImageDefaultDigest = true
+	})
+
+	// Resolution order: exact key > key without tag > longest glob key
+	DescribeTable("resolution order",
+		func(image string, imageDefaultDigest bool, key string) {
+			helpers.CONFIG.ImageDefaultDigest = imageDefaultDigest
+			if key == "" {
+				Expect(helpers.GetTrustedDigestFromMapping(image)).To(BeEmpty())
+			} else {
+				Expect(helpers.GetTrustedDigestFromMapping(image)).To(Equal(digests[key]))
+			}
+		},
+		Entry("exact key wins over globs", "busybox:1.36.1", true, "busybox:1.36.1"),
+		Entry("exact key in another spelling wins over globs", "docker.io/library/busybox:1.36.1", false, "busybox:1.36.1"),
+		Entry("key without tag wins over globs", "busybox:1.36.2", true, "busybox"),
+		Entry("key without tag matches latest", "busybox", false, "busybox"),
+		Entry("longest glob wins", "busybox:1.36.2", false, "*/library/busybox:1.36*"),
+		Entry("shorter glob when the longest does not match", "busybox:1.37", false, "*/library/busybox:*"),
+		Entry("glob matches mirrors", "mirror.local/library/busybox:1.36.0", false, "*/library/busybox:1.36*"),
+		Entry("exact key with registry wins over globs", "registry.corp/team/base:1", false, "registry.corp/team/base:1"),
+		Entry("longest glob with registry wins", "registry.corp/other/base:1.2", false, "registry.corp/*/base:1.*"),
+		Entry("glob with registry", "registry.corp/other/base:2", false, "registry.corp/*/base:*"),
+		Entry("star does not match several path components", "registry.corp/a/b/base:2", false, ""),
+		Entry("glob without tag is default for all tags", "tools/lint:3", true, "tools/*"),
+		Entry("glob without tag matches latest", "tools/lint", false, "tools/*"),
+		Entry("star at the end also matches the tag", "tools/lint:3", false, "tools/*"),
+	)
+})
+
+var _ = Describe("Digest from multi-arch registry", func() {
+	var server *httptest.Server
+	var repository name.Repository
+	var manifestGets atomic.Int32
+	var indexDigest string
+	var amd64Digest string
+	var arm64Digest string
+	var imageDigest string
+
+	BeforeEach(func() {
+		registryHandler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+				manifestGets.Add(1)
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		var err error
+		repository, err = name.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/team/app")
+		Expect(err).NotTo(HaveOccurred())
+
+		index := v1.ImageIndex(empty.Index)
+		for _, platform := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}} {
+			image, err := random.Image(256, 1)
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := image.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			if platform.Architecture == "amd64" {
+				amd64Digest = hash.String()
+			} else {
+				arm64Digest = hash.String()
+			}
+			index = mutate.AppendManifests(index, mutate.IndexAddendum{
+				Add:        image,
+				Descriptor: v1.Descriptor{Platform: &platform},
+			})
+		}
+		Expect(remote.WriteIndex(repository.Tag("multi"), index)).To(Succeed())
+		hash, err := index.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		indexDigest = hash.String()
+
+		image, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(repository.Tag("single"), image)).To(Succeed())
+		hash, err = image.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		imageDigest = hash.String()
+
+		manifestGets.Store(0)
+		helpers.ResetRegistryCache()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		helpers.CONFIG.FetchDigestsHead = false
+		helpers.CONFIG.FetchDigestsPlatformParsed = nil
+		helpers.ResetRegistryCache()
+	})
+
+	// Test GetDigestFromRegistry() with HEAD requests and platform
+	Describe("Get digest from registry", func() {
+		Context("without platform", func() {
+			It("should return index digest", func() {
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("multi").String())).To(Equal(indexDigest))
+			})
+		})
+		Context("with platform", func() {
+			It("should return platform manifest digest", func() {
+				helpers.CONFIG.FetchDigestsPlatformParsed = &v1.Platform{OS: "linux", Architecture: "arm64"}
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("multi").String())).To(Equal(arm64Digest))
+			})
+		})
+		Context("with platform not in index", func() {
+			It("should fail", func() {
+				helpers.CONFIG.FetchDigestsPlatformParsed = &v1.Platform{OS: "windows", Architecture: "amd64"}
+				_, err := helpers.GetDigestFromRegistry(repository.Tag("multi").String())
+				Expect(err).To(HaveOccurred())
+			})
+		})
+		Context("with platform and single arch image", func() {
+			It("should return image digest", func() {
+				helpers.CONFIG.FetchDigestsPlatformParsed = &v1.Platform{OS: "linux", Architecture: "amd64"}
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("single").String())).To(Equal(imageDigest))
+			})
+		})
+		Context("with HEAD requests", func() {
+			It("should not download the manifest", func() {
+				helpers.CONFIG.FetchDigestsHead = true
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("multi").String())).To(Equal(indexDigest))
+				Expect(manifestGets.Load()).To(BeEquivalentTo(0))
+			})
+		})
+		Context("with HEAD requests and platform", func() {
+			It("should download the index to find platform digest", func() {
+				helpers.CONFIG.FetchDigestsHead = true
+				helpers.CONFIG.FetchDigestsPlatformParsed = &v1.Platform{OS: "linux", Architecture: "amd64"}
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("multi").String())).To(Equal(amd64Digest))
+				Expect(manifestGets.Load()).To(BeEquivalentTo(1))
+			})
+		})
+	})
 })
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Date formats accepted for the start of enforcement waves
+var enforcementWaveDateFormats = []string{time.RFC3339, time.DateOnly}
+
+// EnforcementWave denies untrusted pods of its namespaces from its start date, namespaces outside started waves use the global validation mode
+type EnforcementWave struct {
+	// Name of the wave used in logs and metrics
+	Name string `yaml:"name" validate:"required"`
+	// Date from which pods of the namespaces of the wave are denied, RFC3339 or YYYY-MM-DD
+	Start     string    `yaml:"start" validate:"required"`
+	StartTime time.Time `yaml:"-"`
+	// Labels selector of the namespaces of the wave
+	NamespaceSelector       *metav1.LabelSelector `yaml:"namespaceSelector"`
+	NamespaceSelectorLabels labels.Selector       `yaml:"-"`
+	// Percentage of namespaces in the wave chosen by a hash of their name, all namespaces matching the selector when 0
+	Percentage int `yaml:"percentage" validate:"gte=0,lte=100"`
+	// Stop enforcing the wave, its namespaces go back to the global validation mode
+	Paused bool `yaml:"paused"`
+}
+
+// Parse the start date and the namespace selector of the wave
+func (w *EnforcementWave) Prepare() error {
+	var err error
+	for _, format := range enforcementWaveDateFormats {
+		if w.StartTime, err = time.Parse(format, w.Start); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid start %q, expected RFC3339 or YYYY-MM-DD", w.Start)
+	}
+	w.NamespaceSelectorLabels = nil
+	if w.NamespaceSelector != nil {
+		if w.NamespaceSelectorLabels, err = metav1.LabelSelectorAsSelector(w.NamespaceSelector); err != nil {
+			return fmt.Errorf("invalid namespace selector: %w", err)
+		}
+	}
+	return nil
+}
+
+// Return if the namespace is in the wave. A namespace always has the same hash so it stays in waves with a higher percentage.
+func (w *EnforcementWave) Matches(namespace string, namespaceLabels labels.Set) bool {
+	if w.NamespaceSelectorLabels != nil && !w.NamespaceSelectorLabels.Matches(namespaceLabels) {
+		return false
+	}
+	return w.Percentage == 0 || namespaceHashBucket(namespace) < w.Percentage
+}
+
+// Return if pods of the wave are denied at the time
+func (w *EnforcementWave) Enforced(now time.Time) bool {
+	return !w.Paused && !now.Before(w.StartTime)
+}
+
+// Return the bucket of the namespace between 0 and 99
+func namespaceHashBucket(namespace string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(namespace))
+	return int(hash.Sum32() % 100)
+}
+
+// Return the first wave of the config matching the namespace, nil if the namespace is in no wave
+func GetEnforcementWave(namespace string, namespaceLabels labels.Set) *EnforcementWave {
+	for i := range CONFIG.EnforcementWaves {
+		if CONFIG.EnforcementWaves[i].Matches(namespace, namespaceLabels) {
+			return &CONFIG.EnforcementWaves[i]
+		}
+	}
+	return nil
+}
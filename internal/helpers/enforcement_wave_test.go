@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Enforcement waves", func() {
+	var previous []helpers.EnforcementWave
+
+	BeforeEach(func() {
+		previous = helpers.CONFIG.EnforcementWaves
+	})
+	AfterEach(func() {
+		helpers.CONFIG.EnforcementWaves = previous
+	})
+
+	It("should parse dates and datetimes", func() {
+		wave := helpers.EnforcementWave{Name: "first", Start: "2025-07-01"}
+		Expect(wave.Prepare()).To(Succeed())
+		Expect(wave.StartTime).To(BeTemporally("==", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)))
+		wave.Start = "2025-07-01T08:00:00+02:00"
+		Expect(wave.Prepare()).To(Succeed())
+		Expect(wave.StartTime).To(BeTemporally("==", time.Date(2025, 7, 1, 6, 0, 0, 0, time.UTC)))
+		wave.Start = "next monday"
+		Expect(wave.Prepare()).To(MatchError(ContainSubstring("invalid start")))
+	})
+	It("should be enforced from its start until it is paused", func() {
+		wave := helpers.EnforcementWave{Name: "first", Start: "2025-07-01"}
+		Expect(wave.Prepare()).To(Succeed())
+		Expect(wave.Enforced(time.Date(2025, 6, 30, 23, 59, 0, 0, time.UTC))).To(BeFalse())
+		Expect(wave.Enforced(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+		wave.Paused = true
+		Expect(wave.Enforced(time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC))).To(BeFalse())
+	})
+	It("should keep namespaces of a percentage in waves with a higher percentage", func() {
+		small := helpers.EnforcementWave{Name: "small", Start: "2025-07-01", Percentage: 10}
+		large := helpers.EnforcementWave{Name: "large", Start: "2025-08-01", Percentage: 50}
+		Expect(small.Prepare()).To(Succeed())
+		Expect(large.Prepare()).To(Succeed())
+		inSmall := 0
+		for i := range 1000 {
+			namespace := fmt.Sprintf("team-%d", i)
+			if small.Matches(namespace, nil) {
+				inSmall++
+				Expect(large.Matches(namespace, nil)).To(BeTrue())
+			}
+		}
+		Expect(inSmall).To(BeNumerically("~", 100, 40))
+	})
+	It("should return the first wave matching the namespace labels", func() {
+		helpers.CONFIG.EnforcementWaves = []helpers.EnforcementWave{
+			{Name: "pilots", Start: "2025-07-01", NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"enforcement": "pilot"}}},
+			{Name: "everyone", Start: "2025-09-01"},
+		}
+		for i := range helpers.CONFIG.EnforcementWaves {
+			Expect(helpers.CONFIG.EnforcementWaves[i].Prepare()).To(Succeed())
+		}
+		Expect(helpers.GetEnforcementWave("team-a", labels.Set{"enforcement": "pilot"}).Name).To(Equal("pilots"))
+		Expect(helpers.GetEnforcementWave("team-b", nil).Name).To(Equal("everyone"))
+		helpers.CONFIG.EnforcementWaves = helpers.CONFIG.EnforcementWaves[:1]
+		Expect(helpers.GetEnforcementWave("team-b", nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+// Number of recently emitted events remembered to drop duplicates
+const recentEventsSize = 1000
+
+type EventsConfig struct {
+	// Emit Kubernetes events for denials, warnings, deletions and break-glass
+	Enabled bool `yaml:"enabled"`
+	// Number of events emitted per minute on average, additional events are dropped
+	PerMinute int `yaml:"perMinute" validate:"gt=0"`
+	// Number of events that can be emitted at once above the average rate
+	Burst int `yaml:"burst" validate:"gt=0"`
+	// Time during which an event with the same object, reason and message is not emitted again in seconds
+	DuplicateInterval int `yaml:"duplicateInterval" validate:"gte=0"`
+}
+
+// rateLimitedRecorder drops events above the rate of the config and events already emitted during the duplicate interval
+type rateLimitedRecorder struct {
+	recorder record.EventRecorder
+	limiter  *rate.Limiter
+	recent   *lruCache[struct{}]
+}
+
+// Return a recorder emitting events of the recorder with the limits of the config, nil if events are disabled
+func NewEventRecorder(recorder record.EventRecorder) record.EventRecorder {
+	if !CONFIG.Events.Enabled || recorder == nil {
+		return nil
+	}
+	return &rateLimitedRecorder{
+		recorder: recorder,
+		limiter:  rate.NewLimiter(rate.Limit(float64(CONFIG.Events.PerMinute)/60), CONFIG.Events.Burst),
+		recent:   newLRUCache[struct{}](recentEventsSize),
+	}
+}
+
+func (r *rateLimitedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.allow(object, reason, message) {
+		r.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *rateLimitedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *rateLimitedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.allow(object, reason, message) {
+		r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+// Return if the event can be emitted and remember it to drop its duplicates
+func (r *rateLimitedRecorder) allow(object runtime.Object, reason string, message string) bool {
+	key := eventObjectKey(object) + "/" + reason + "/" + message
+	if _, found := r.recent.Get(key); found {
+		metrics.GomenhashaiEventsDropped.WithLabelValues("duplicate").Inc()
+		return false
+	}
+	if !r.limiter.Allow() {
+		metrics.GomenhashaiEventsDropped.WithLabelValues("rate").Inc()
+		return false
+	}
+	r.recent.Set(key, struct{}{}, time.Duration(CONFIG.Events.DuplicateInterval)*time.Second)
+	return true
+}
+
+// Return the kind, namespace and name of the object of an event
+func eventObjectKey(object runtime.Object) string {
+	if ref, ok := object.(*corev1.ObjectReference); ok {
+		return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+	}
+	kind := fmt.Sprintf("%T", object)
+	if accessor, err := meta.Accessor(object); err == nil {
+		return kind + "/" + accessor.GetNamespace() + "/" + accessor.GetName()
+	}
+	return kind
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		previous helpers.EventsConfig
+		fake     *record.FakeRecorder
+	)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+
+	BeforeEach(func() {
+		previous = helpers.CONFIG.Events
+		helpers.CONFIG.Events = helpers.EventsConfig{Enabled: true, PerMinute: 60, Burst: 2, DuplicateInterval: 300}
+		fake = record.NewFakeRecorder(10)
+	})
+	AfterEach(func() {
+		helpers.CONFIG.Events = previous
+	})
+
+	It("should not emit events when disabled", func() {
+		helpers.CONFIG.Events.Enabled = false
+		Expect(helpers.NewEventRecorder(fake)).To(BeNil())
+	})
+	It("should drop duplicated events", func() {
+		recorder := helpers.NewEventRecorder(fake)
+		recorder.Eventf(pod, corev1.EventTypeWarning, "ImageDenied", "Container %s denied", "app")
+		recorder.Eventf(pod, corev1.EventTypeWarning, "ImageDenied", "Container %s denied", "app")
+		other := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+		recorder.Eventf(other, corev1.EventTypeWarning, "ImageDenied", "Container %s denied", "app")
+		Expect(fake.Events).To(HaveLen(2))
+	})
+	It("should drop events above the burst", func() {
+		recorder := helpers.NewEventRecorder(fake)
+		for _, container := range []string{"app", "sidecar", "init"} {
+			recorder.Eventf(pod, corev1.EventTypeWarning, "ImageDenied", "Container %s denied", container)
+		}
+		Expect(fake.Events).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,172 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+// Kinds of image patterns, written as "kind:pattern"
+const (
+	MatcherExact = "exact"
+	MatcherRegex = "regex"
+	MatcherGlob  = "glob"
+)
+
+// ImageMatcher matches images with an exact reference, an anchored regex or a glob
+type ImageMatcher struct {
+	// Pattern as written in config
+	Entry   string
+	Kind    string
+	Pattern string
+	regexp  *regexp.Regexp
+}
+
+// Parse a pattern prefixed with its kind, patterns without prefix are exact if they are a valid image reference and regex otherwise
+func ParseImageMatcher(entry string) (ImageMatcher, error) {
+	matcher := ImageMatcher{Entry: entry, Pattern: entry}
+	kind, pattern, found := strings.Cut(entry, ":")
+	switch {
+	case found && (kind == MatcherExact || kind == MatcherRegex || kind == MatcherGlob):
+		matcher.Kind = kind
+		matcher.Pattern = pattern
+	case isImageReference(entry):
+		matcher.Kind = MatcherExact
+	default:
+		matcher.Kind = MatcherRegex
+	}
+
+	switch matcher.Kind {
+	case MatcherRegex:
+		re, err := regexp.Compile("^(?:" + matcher.Pattern + ")$")
+		if err != nil {
+			return matcher, fmt.Errorf("invalid regex %q: %w", entry, err)
+		}
+		matcher.regexp = re
+	case MatcherGlob:
+		if _, err := path.Match(matcher.Pattern, ""); err != nil {
+			return matcher, fmt.Errorf("invalid glob %q: %w", entry, err)
+		}
+	}
+	return matcher, nil
+}
+
+func isImageReference(image string) bool {
+	_, err := name.ParseReference(image, name.WeakValidation)
+	return err == nil
+}
+
+// Return if the image, with or without its digest, matches the pattern. Exact patterns compare canonical references.
+func (m ImageMatcher) Match(image string) bool {
+	imageWithoutDigest, _ := SplitImageDigest(image)
+	switch m.Kind {
+	case MatcherExact:
+		return image == m.Pattern || CanonicalImage(imageWithoutDigest) == CanonicalImage(m.Pattern)
+	case MatcherRegex:
+		return m.regexp.MatchString(image) || m.regexp.MatchString(imageWithoutDigest)
+	case MatcherGlob:
+		match, _ := path.Match(m.Pattern, image)
+		if !match {
+			match, _ = path.Match(m.Pattern, imageWithoutDigest)
+		}
+		return match
+	}
+	return false
+}
+
+// Parse a list of patterns, the first invalid pattern is returned as error
+func ParseImageMatchers(entries []string) ([]ImageMatcher, error) {
+	matchers := make([]ImageMatcher, 0, len(entries))
+	for _, entry := range entries {
+		matcher, err := ParseImageMatcher(entry)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// Return the first matcher matching the image or nil
+func matchImage(matchers []ImageMatcher, image string) *ImageMatcher {
+	for i := range matchers {
+		if matchers[i].Match(image) {
+			return &matchers[i]
+		}
+	}
+	return nil
+}
+
+// Return if an exemption of the list matches the image and count the hit of this exemption
+func matchExemptions(matchers []ImageMatcher, list string, image string) bool {
+	matcher := matchImage(matchers, image)
+	if matcher == nil {
+		return false
+	}
+	metrics.GomenhashaiExemptionHits.WithLabelValues(list, matcher.Entry).Inc()
+	return true
+}
+
+// Names of the exemption lists in metrics
+const (
+	exemptionListGlobal    = "exemptions"
+	exemptionListEphemeral = "ephemeralContainerExemptions"
+)
+
+func namespacePolicyExemptionList(policy string) string {
+	return "namespacePolicies/" + policy
+}
+
+// Parse exemptions and exemption rules of the config and namespace policies, exemptions are reported in metrics even without hits so unused ones can be pruned
+func (c *Config) PrepareExemptions() error {
+	var err error
+	if c.ExemptionsParsed, err = ParseImageMatchers(c.Exemptions); err != nil {
+		return fmt.Errorf("invalid exemptions: %w", err)
+	}
+	if c.EphemeralContainerExemptionsParsed, err = ParseImageMatchers(c.EphemeralContainerExemptions); err != nil {
+		return fmt.Errorf("invalid ephemeral container exemptions: %w", err)
+	}
+	lists := map[string][]ImageMatcher{
+		exemptionListGlobal:    c.ExemptionsParsed,
+		exemptionListEphemeral: c.EphemeralContainerExemptionsParsed,
+	}
+	for i, policy := range c.NamespacePolicies {
+		if c.NamespacePolicies[i].ExemptionsParsed, err = ParseImageMatchers(policy.Exemptions); err != nil {
+			return fmt.Errorf("invalid exemptions in namespace policy %s: %w", policy.Name, err)
+		}
+		lists[namespacePolicyExemptionList(policy.Name)] = c.NamespacePolicies[i].ExemptionsParsed
+	}
+	for i, rule := range c.ExemptionRules {
+		if err := c.ExemptionRules[i].Prepare(); err != nil {
+			return fmt.Errorf("invalid exemption rule %s: %w", rule.Name, err)
+		}
+		metrics.GomenhashaiExemptionHits.WithLabelValues(exemptionListRules, rule.Name)
+	}
+	for list, matchers := range lists {
+		for _, matcher := range matchers {
+			metrics.GomenhashaiExemptionHits.WithLabelValues(list, matcher.Entry)
+		}
+	}
+	return nil
+}
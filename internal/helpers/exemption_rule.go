@@ -0,0 +1,145 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+// Name of the exemption rules list in metrics
+const exemptionListRules = "exemptionRules"
+
+// Service account used by pods that do not set one
+const defaultServiceAccount = "default"
+
+// ExemptionRule skips containers of the pods matching all the criteria it sets
+type ExemptionRule struct {
+	// Name of the rule used in logs and metrics
+	Name string `yaml:"name" validate:"required"`
+	// Names of the namespaces of the pods
+	Namespaces []string `yaml:"namespaces"`
+	// Labels selector of the namespaces of the pods
+	NamespaceSelector       *metav1.LabelSelector `yaml:"namespaceSelector"`
+	NamespaceSelectorLabels labels.Selector       `yaml:"-"`
+	// Service accounts names of the pods
+	ServiceAccounts []string `yaml:"serviceAccounts"`
+	// Labels selector of the pods
+	PodSelector       *metav1.LabelSelector `yaml:"podSelector"`
+	PodSelectorLabels labels.Selector       `yaml:"-"`
+	// Images skipped in these pods, same format as exemptions, all images if empty
+	Images       []string       `yaml:"images"`
+	ImagesParsed []ImageMatcher `yaml:"-"`
+}
+
+// PodContext holds the attributes of a pod matched by exemption rules
+type PodContext struct {
+	Namespace       string
+	NamespaceLabels labels.Set
+	ServiceAccount  string
+	Labels          labels.Set
+}
+
+// Parse the selectors and images of the rule
+func (r *ExemptionRule) Prepare() error {
+	if len(r.Namespaces) == 0 && r.NamespaceSelector == nil && len(r.ServiceAccounts) == 0 && r.PodSelector == nil && len(r.Images) == 0 {
+		return fmt.Errorf("at least one of namespaces, namespaceSelector, serviceAccounts, podSelector or images is required")
+	}
+	var err error
+	r.NamespaceSelectorLabels = nil
+	if r.NamespaceSelector != nil {
+		if r.NamespaceSelectorLabels, err = metav1.LabelSelectorAsSelector(r.NamespaceSelector); err != nil {
+			return fmt.Errorf("invalid namespace selector: %w", err)
+		}
+	}
+	r.PodSelectorLabels = nil
+	if r.PodSelector != nil {
+		if r.PodSelectorLabels, err = metav1.LabelSelectorAsSelector(r.PodSelector); err != nil {
+			return fmt.Errorf("invalid pod selector: %w", err)
+		}
+	}
+	if r.ImagesParsed, err = ParseImageMatchers(r.Images); err != nil {
+		return fmt.Errorf("invalid images: %w", err)
+	}
+	return nil
+}
+
+// Return if the pod and image match all the criteria of the rule
+func (r *ExemptionRule) Matches(pod PodContext, image string) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, pod.Namespace) {
+		return false
+	}
+	if r.NamespaceSelectorLabels != nil && !r.NamespaceSelectorLabels.Matches(pod.NamespaceLabels) {
+		return false
+	}
+	serviceAccount := pod.ServiceAccount
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+	if len(r.ServiceAccounts) > 0 && !slices.Contains(r.ServiceAccounts, serviceAccount) {
+		return false
+	}
+	if r.PodSelectorLabels != nil && !r.PodSelectorLabels.Matches(pod.Labels) {
+		return false
+	}
+	if len(r.ImagesParsed) > 0 && matchImage(r.ImagesParsed, image) == nil {
+		return false
+	}
+	return true
+}
+
+// Return the first exemption rule matching the pod and image or nil and count the hit of this rule
+func GetExemptionRule(pod PodContext, image string) *ExemptionRule {
+	rule := MatchExemptionRule(pod, image)
+	if rule != nil {
+		metrics.GomenhashaiExemptionHits.WithLabelValues(exemptionListRules, rule.Name).Inc()
+	}
+	return rule
+}
+
+// Return the first exemption rule matching the pod and image or nil without counting the hit
+func MatchExemptionRule(pod PodContext, image string) *ExemptionRule {
+	for i := range CONFIG.ExemptionRules {
+		if CONFIG.ExemptionRules[i].Matches(pod, image) {
+			return &CONFIG.ExemptionRules[i]
+		}
+	}
+	return nil
+}
+
+// Return if some exemption rules, namespace policies or enforcement waves need the namespace labels to be matched
+func NamespaceSelectorsUsed() bool {
+	if NamespacePoliciesUseSelector() {
+		return true
+	}
+	for _, rule := range CONFIG.ExemptionRules {
+		if rule.NamespaceSelector != nil {
+			return true
+		}
+	}
+	for _, wave := range CONFIG.EnforcementWaves {
+		if wave.NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+// Return the value of the exemption hit counter
+func exemptionHits(list string, exemption string) float64 {
+	metric := &dto.Metric{}
+	Expect(metrics.GomenhashaiExemptionHits.WithLabelValues(list, exemption).Write(metric)).To(Succeed())
+	return metric.GetCounter().GetValue()
+}
+
+var _ = Describe("Exemptions", func() {
+	match := func(entry string, image string) bool {
+		matcher, err := helpers.ParseImageMatcher(entry)
+		Expect(err).ToNot(HaveOccurred())
+		return matcher.Match(image)
+	}
+
+	Describe("Parse matchers", func() {
+		It("should use the kind of the prefix", func() {
+			for entry, kind := range map[string]string{
+				"exact:nginx:1.2":         helpers.MatcherExact,
+				"regex:nginx:1.2":         helpers.MatcherRegex,
+				"glob:registry.corp/*":    helpers.MatcherGlob,
+				"nginx:1.2":               helpers.MatcherExact,
+				".*redis:.*":              helpers.MatcherRegex,
+				"my-registry.safe/.*":     helpers.MatcherRegex,
+				"localhost:5000/team/app": helpers.MatcherExact,
+			} {
+				matcher, err := helpers.ParseImageMatcher(entry)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(matcher.Kind).To(Equal(kind), entry)
+			}
+		})
+		It("should reject invalid patterns", func() {
+			_, err := helpers.ParseImageMatcher("regex:nginx:(")
+			Expect(err).To(HaveOccurred())
+			_, err = helpers.ParseImageMatcher("glob:nginx:[")
+			Expect(err).To(HaveOccurred())
+			_, err = helpers.ParseImageMatcher("[a-")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject invalid exemptions of config and namespace policies", func() {
+			cfg := helpers.Config{Exemptions: []string{"regex:("}}
+			Expect(cfg.PrepareExemptions()).To(MatchError(ContainSubstring("invalid exemptions")))
+			cfg = helpers.Config{NamespacePolicies: []helpers.NamespacePolicy{{Name: "team", Exemptions: []string{"glob:["}}}}
+			Expect(cfg.PrepareExemptions()).To(MatchError(ContainSubstring("namespace policy team")))
+		})
+		It("should reject exemption rules without criteria or with invalid selectors", func() {
+			cfg := helpers.Config{ExemptionRules: []helpers.ExemptionRule{{Name: "everything"}}}
+			Expect(cfg.PrepareExemptions()).To(MatchError(ContainSubstring("exemption rule everything")))
+			cfg = helpers.Config{ExemptionRules: []helpers.ExemptionRule{{
+				Name:        "bad-selector",
+				PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Around"}}},
+			}}}
+			Expect(cfg.PrepareExemptions()).To(MatchError(ContainSubstring("invalid pod selector")))
+		})
+	})
+
+	Describe("Match images", func() {
+		It("should compare exact patterns as canonical references", func() {
+			Expect(match("nginx:1.2", "nginx:1.2")).To(BeTrue())
+			Expect(match("nginx:1.2", "docker.io/library/nginx:1.2@sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549")).To(BeTrue())
+			Expect(match("nginx:1.2", "nginx:132")).To(BeFalse())
+			Expect(match("nginx:1.2", "nginx:1.23")).To(BeFalse())
+		})
+		It("should anchor regex", func() {
+			Expect(match("regex:nginx:1\\.2", "nginx:1.2")).To(BeTrue())
+			Expect(match("regex:nginx:1\\.2", "nginx:1.23")).To(BeFalse())
+			Expect(match("regex:nginx:1\\.2", "my-registry/nginx:1.2")).To(BeFalse())
+			Expect(match(".*redis:.*", "lib/redis:6")).To(BeTrue())
+		})
+		It("should match globs by path component", func() {
+			Expect(match("glob:registry.corp/*", "registry.corp/app:1")).To(BeTrue())
+			Expect(match("glob:registry.corp/*", "registry.corp/team/app:1")).To(BeFalse())
+			Expect(match("glob:registry.corp/*/*", "registry.corp/team/app:1@sha256:e246aa22ad2cbdfbd19e2a6ca2b275e26245a21920e2b2d0666324cee3f15549")).To(BeTrue())
+		})
+	})
+
+	Describe("Exemption rules", func() {
+		rule := helpers.ExemptionRule{
+			Name:            "velero-restore",
+			Namespaces:      []string{"velero"},
+			ServiceAccounts: []string{"velero"},
+			PodSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"component": "restore"}},
+			Images:          []string{"glob:velero/*"},
+		}
+		pod := helpers.PodContext{
+			Namespace:      "velero",
+			ServiceAccount: "velero",
+			Labels:         map[string]string{"component": "restore"},
+		}
+
+		BeforeEach(func() {
+			Expect(rule.Prepare()).To(Succeed())
+		})
+		It("should match when all criteria match", func() {
+			Expect(rule.Matches(pod, "velero/velero-restore-helper:v1.16")).To(BeTrue())
+		})
+		It("should not match when one criterion differs", func() {
+			Expect(rule.Matches(pod, "busybox:stable")).To(BeFalse())
+			other := pod
+			other.ServiceAccount = ""
+			Expect(rule.Matches(other, "velero/velero-restore-helper:v1.16")).To(BeFalse())
+			other = pod
+			other.Namespace = "default"
+			Expect(rule.Matches(other, "velero/velero-restore-helper:v1.16")).To(BeFalse())
+			other = pod
+			other.Labels = nil
+			Expect(rule.Matches(other, "velero/velero-restore-helper:v1.16")).To(BeFalse())
+		})
+		It("should use the default service account when pod does not set one", func() {
+			defaultRule := helpers.ExemptionRule{Name: "default-sa", ServiceAccounts: []string{"default"}}
+			Expect(defaultRule.Prepare()).To(Succeed())
+			Expect(defaultRule.Matches(helpers.PodContext{Namespace: "default"}, "busybox:stable")).To(BeTrue())
+		})
+	})
+
+	Describe("Hit counters", func() {
+		var previous helpers.Config
+
+		BeforeEach(func() {
+			previous = helpers.CONFIG
+			helpers.CONFIG.Exemptions = []string{"exact:busybox:hits", "exact:busybox:unused"}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+		})
+		AfterEach(func() {
+			helpers.CONFIG = previous
+		})
+		It("should count hits per exemption", func() {
+			before := exemptionHits("exemptions", "exact:busybox:hits")
+			Expect(helpers.IsImageExempt("busybox:hits")).To(BeTrue())
+			Expect(helpers.IsImageExempt("busybox:misses")).To(BeFalse())
+			Expect(exemptionHits("exemptions", "exact:busybox:hits")).To(Equal(before + 1))
+			Expect(exemptionHits("exemptions", "exact:busybox:unused")).To(BeZero())
+		})
+	})
+})
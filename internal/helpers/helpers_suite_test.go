@@ -40,6 +40,7 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 
 	helpers.CONFIG.Exemptions = []string{".*redis:.*", "", "docker.io/.*"}
+	Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
 
 	// Load test mapping
 	err = helpers.LoadDigestMapping()
@@ -0,0 +1,120 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespacePolicy overrides the global config for the namespaces it matches
+type NamespacePolicy struct {
+	// Name of the policy used in logs
+	Name string `yaml:"name" validate:"required"`
+	// Names of the namespaces the policy applies to
+	Namespaces []string `yaml:"namespaces"`
+	// Labels selector of the namespaces the policy applies to
+	NamespaceSelector       *metav1.LabelSelector `yaml:"namespaceSelector"`
+	NamespaceSelectorLabels labels.Selector       `yaml:"-"`
+	// Can be warn, fail or audit, default to global validationMode
+	ValidationMode string `yaml:"validationMode" validate:"omitempty,oneof=warn fail audit"`
+	// List of images to skip in addition to global exemptions, same format as global exemptions
+	Exemptions       []string       `yaml:"exemptions"`
+	ExemptionsParsed []ImageMatcher `yaml:"-"`
+	// Digests trusted in these namespaces in addition to the trusted digests, same format as the digests mapping
+	TrustedDigests map[string]DigestList `yaml:"trustedDigests"`
+}
+
+// Return the first namespace policy matching the namespace name or labels, nil if none applies
+func GetNamespacePolicy(namespace string, namespaceLabels labels.Set) *NamespacePolicy {
+	for i, policy := range CONFIG.NamespacePolicies {
+		if slices.Contains(policy.Namespaces, namespace) {
+			return &CONFIG.NamespacePolicies[i]
+		}
+		if policy.NamespaceSelectorLabels != nil && policy.NamespaceSelectorLabels.Matches(namespaceLabels) {
+			return &CONFIG.NamespacePolicies[i]
+		}
+	}
+	return nil
+}
+
+// Return if some namespace policies need the namespace labels to be matched
+func NamespacePoliciesUseSelector() bool {
+	for _, policy := range CONFIG.NamespacePolicies {
+		if policy.NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Return if the image is exempted globally or by the policy, policy can be nil
+func (p *NamespacePolicy) IsImageExempt(image string) bool {
+	if IsImageExempt(image) {
+		return true
+	}
+	return p != nil && matchExemptions(p.ExemptionsParsed, namespacePolicyExemptionList(p.Name), image)
+}
+
+// Return if the image of an ephemeral container is exempted globally or by the policy, policy can be nil
+func (p *NamespacePolicy) IsEphemeralImageExempt(image string) bool {
+	return p.IsImageExempt(image) || matchExemptions(CONFIG.EphemeralContainerExemptionsParsed, exemptionListEphemeral, image)
+}
+
+// Return if the image is exempted globally or by the policy without counting the hit, ephemeralContainerExemptions also applies to ephemeral containers, policy can be nil
+func (p *NamespacePolicy) MatchesExemption(image string, ephemeral bool) bool {
+	if matchImage(CONFIG.ExemptionsParsed, image) != nil || (p != nil && matchImage(p.ExemptionsParsed, image) != nil) {
+		return true
+	}
+	return ephemeral && matchImage(CONFIG.EphemeralContainerExemptionsParsed, image) != nil
+}
+
+// Return the digest to inject for the image and the source that trusts it, policy can be nil.
+// The preference applies to the digests of the trust chain source on its own, the digests trusted
+// by the policy are only used when the trust chain has none so "newest" never picks a policy digest over the mapping.
+func (p *NamespacePolicy) ResolvePreferredDigest(image string) (string, string, error) {
+	digests, source, err := ResolveTrustedDigests(image, "")
+	if digest := PreferredDigest(digests); digest != "" || p == nil {
+		return digest, source, err
+	}
+	policyDigests, _ := lookupMapping(p.TrustedDigests, image)
+	if digest := PreferredDigest(policyDigests); digest != "" {
+		return digest, TrustSourceNamespacePolicy, nil
+	}
+	return "", source, err
+}
+
+// Return trusted digests of the trust chain and of the policy and the source that trusts them, policy can be nil
+func (p *NamespacePolicy) ResolveTrustedDigests(image string, digest string) ([]string, string, error) {
+	digests, source, err := ResolveTrustedDigests(image, digest)
+	if p == nil {
+		return digests, source, err
+	}
+	policyDigests, _ := lookupMapping(p.TrustedDigests, image)
+	for _, policyDigest := range policyDigests {
+		if !slices.Contains(digests, policyDigest) {
+			digests = append(digests, policyDigest)
+		}
+	}
+	if source == "" && len(digests) > 0 {
+		source = TrustSourceNamespacePolicy
+		err = nil
+	}
+	return digests, source, err
+}
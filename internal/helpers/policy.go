@@ -0,0 +1,70 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Trusted digests loaded from each TrustedDigestPolicy, by policy name
+var POLICY_DIGESTS = map[string]map[string][]string{}
+
+// Trusted digests of all policies merged, by image
+var policyMapping = map[string][]string{}
+var policyDigestsLock sync.RWMutex
+
+// Replace the trusted digests of a policy
+func SetPolicyDigests(policy string, mapping map[string][]string) {
+	policyDigestsLock.Lock()
+	defer policyDigestsLock.Unlock()
+	POLICY_DIGESTS[policy] = mapping
+	mergePolicyDigests()
+}
+
+// Remove the trusted digests of a deleted policy
+func DeletePolicyDigests(policy string) {
+	policyDigestsLock.Lock()
+	defer policyDigestsLock.Unlock()
+	delete(POLICY_DIGESTS, policy)
+	mergePolicyDigests()
+}
+
+// Rebuild the merged mapping, policies are merged in name order so digests order is stable
+func mergePolicyDigests() {
+	merged := map[string][]string{}
+	for _, policy := range slices.Sorted(maps.Keys(POLICY_DIGESTS)) {
+		for image, digests := range POLICY_DIGESTS[policy] {
+			for _, digest := range digests {
+				if !slices.Contains(merged[image], digest) {
+					merged[image] = append(merged[image], digest)
+				}
+			}
+		}
+	}
+	policyMapping = merged
+}
+
+// Return digests trusted by policies for this image or empty list
+func GetTrustedDigestsFromPolicies(image string) []string {
+	policyDigestsLock.RLock()
+	mapping := policyMapping
+	policyDigestsLock.RUnlock()
+	digests, _ := lookupMapping(mapping, image)
+	return digests
+}
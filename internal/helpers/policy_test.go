@@ -0,0 +1,95 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Policy", func() {
+	var digestA string
+	var digestB string
+	var digestCurl string
+
+	BeforeEach(func() {
+		digestA = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		digestB = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+		digestCurl = helpers.DIGEST_MAPPING["curlimages/curl:8.13.0"][0]
+		helpers.CONFIG.TrustedDigestPolicies = true
+		helpers.SetPolicyDigests("team-a", map[string][]string{
+			"myapp:stable":           {digestA},
+			"curlimages/curl:8.13.0": {digestA},
+		})
+		helpers.SetPolicyDigests("team-b", map[string][]string{
+			"myapp:stable": {digestB, digestA},
+		})
+	})
+
+	AfterEach(func() {
+		helpers.CONFIG.TrustedDigestPolicies = false
+		helpers.DeletePolicyDigests("team-a")
+		helpers.DeletePolicyDigests("team-b")
+	})
+
+	// Test GetTrustedDigestsFromPolicies()
+	Describe("Get trusted digests from policies", func() {
+		Context("with image in several policies", func() {
+			It("should merge digests without duplicates", func() {
+				Expect(helpers.GetTrustedDigestsFromPolicies("myapp:stable")).To(Equal([]string{digestA, digestB}))
+			})
+		})
+		Context("with registry", func() {
+			It("should match policy image without registry", func() {
+				Expect(helpers.GetTrustedDigestsFromPolicies("myregistry.test/myapp:stable")).To(Equal([]string{digestA, digestB}))
+			})
+		})
+		Context("with deleted policy", func() {
+			It("should drop its digests", func() {
+				helpers.DeletePolicyDigests("team-b")
+				Expect(helpers.GetTrustedDigestsFromPolicies("myapp:stable")).To(Equal([]string{digestA}))
+			})
+		})
+		Context("with unknown image", func() {
+			It("should be empty", func() {
+				Expect(helpers.GetTrustedDigestsFromPolicies("myapp:unknown")).To(BeEmpty())
+			})
+		})
+	})
+
+	// Test GetTrustedDigests()
+	Describe("Get trusted digests", func() {
+		Context("with image in mapping and policies", func() {
+			It("should return mapping digests only", func() {
+				Expect(helpers.GetTrustedDigests("curlimages/curl:8.13.0")).To(Equal([]string{digestCurl}))
+			})
+		})
+		Context("with image in policies only", func() {
+			It("should return policies digests", func() {
+				Expect(helpers.GetTrustedDigests("myapp:stable")).To(Equal([]string{digestA, digestB}))
+			})
+		})
+		Context("with policies disabled", func() {
+			It("should ignore policies", func() {
+				helpers.CONFIG.TrustedDigestPolicies = false
+				Expect(helpers.GetTrustedDigests("myapp:stable")).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+// lruCache is a size bounded cache whose entries expire, least recently used entries are evicted first
+type lruCache[V any] struct {
+	lock    sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Return the value of the key if it is cached and not expired
+func (c *lruCache[V]) Get(key string) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var empty V
+	element, ok := c.entries[key]
+	if !ok {
+		return empty, false
+	}
+	entry := element.Value.(*lruEntry[V])
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return empty, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Cache the value of the key for ttl, nothing is cached if size or ttl is 0
+func (c *lruCache[V]) Set(key string, value V, ttl time.Duration) {
+	if c.size <= 0 || ttl <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := &lruEntry[V]{key: key, value: value, expires: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+type registryLookup struct {
+	digest string
+	err    error
+}
+
+var registryCache = newLRUCache[registryLookup](defaultConfig().RegistryCache.Size)
+var registryCacheLock sync.RWMutex
+var registryLookups singleflight.Group
+
+// Drop all cached digests and apply the cache size from config
+func ResetRegistryCache() {
+	registryCacheLock.Lock()
+	defer registryCacheLock.Unlock()
+	registryCache = newLRUCache[registryLookup](CONFIG.RegistryCache.Size)
+}
+
+// Return the digest of the reference from cache or call lookup once for all concurrent callers and cache its result
+func cachedRegistryLookup(reference string, lookup func() (string, error)) (string, error) {
+	registryCacheLock.RLock()
+	cache := registryCache
+	registryCacheLock.RUnlock()
+
+	if result, ok := cache.Get(reference); ok {
+		metrics.GomenhashaiRegistryCacheHits.Inc()
+		return result.digest, result.err
+	}
+	metrics.GomenhashaiRegistryCacheMisses.Inc()
+
+	value, _, _ := registryLookups.Do(reference, func() (any, error) {
+		digest, err := lookup()
+		ttl := time.Duration(CONFIG.RegistryCache.TTL) * time.Second
+		if err != nil {
+			ttl = time.Duration(CONFIG.RegistryCache.NegativeTTL) * time.Second
+		}
+		cache.Set(reference, registryLookup{digest: digest, err: err}, ttl)
+		return registryLookup{digest: digest, err: err}, nil
+	})
+	result := value.(registryLookup)
+	return result.digest, result.err
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+)
+
+var _ = Describe("Registry cache", func() {
+	var server *httptest.Server
+	var repository name.Repository
+	var manifestRequests atomic.Int32
+	var digest string
+	var previousCache helpers.RegistryCacheConfig
+
+	BeforeEach(func() {
+		registryHandler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+		manifestRequests.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") {
+				manifestRequests.Add(1)
+				// Slow registry so concurrent lookups overlap
+				time.Sleep(50 * time.Millisecond)
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		var err error
+		repository, err = name.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/team/app")
+		Expect(err).NotTo(HaveOccurred())
+		image, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(repository.Tag("v1"), image)).To(Succeed())
+		Expect(remote.Write(repository.Tag("latest"), image)).To(Succeed())
+		hash, err := image.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		digest = hash.String()
+		otherImage, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(repository.Tag("v2"), otherImage)).To(Succeed())
+		manifestRequests.Store(0)
+
+		previousCache = helpers.CONFIG.RegistryCache
+		helpers.CONFIG.RegistryCache = helpers.RegistryCacheConfig{Size: 10, TTL: 300, NegativeTTL: 300}
+		helpers.ResetRegistryCache()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		helpers.CONFIG.RegistryCache = previousCache
+		helpers.ResetRegistryCache()
+	})
+
+	// Test GetDigestFromRegistry() with cache
+	Describe("Get digest from registry with cache", func() {
+		Context("with cached reference", func() {
+			It("should not query the registry again", func() {
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("v1").String())).To(Equal(digest))
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("v1").String())).To(Equal(digest))
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(1))
+			})
+		})
+		Context("with references normalized to the same name", func() {
+			It("should share the cache entry", func() {
+				Expect(helpers.GetDigestFromRegistry(repository.String())).To(Equal(digest))
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("latest").String())).To(Equal(digest))
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(1))
+			})
+		})
+		Context("with failed lookup", func() {
+			It("should cache the failure", func() {
+				_, err := helpers.GetDigestFromRegistry(repository.Tag("missing").String())
+				Expect(err).To(HaveOccurred())
+				_, err = helpers.GetDigestFromRegistry(repository.Tag("missing").String())
+				Expect(err).To(HaveOccurred())
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(1))
+			})
+		})
+		Context("with registry metrics", func() {
+			It("should count errors by status class and time lookups", func() {
+				errors := &dto.Metric{}
+				Expect(metrics.GomenhashaiRegistryErrors.WithLabelValues("other", "4xx").Write(errors)).To(Succeed())
+				before := errors.GetCounter().GetValue()
+				_, err := helpers.GetDigestFromRegistry(repository.Tag("missing").String())
+				Expect(err).To(HaveOccurred())
+				Expect(metrics.GomenhashaiRegistryErrors.WithLabelValues("other", "4xx").Write(errors)).To(Succeed())
+				Expect(errors.GetCounter().GetValue()).To(Equal(before + 1))
+
+				duration := &dto.Metric{}
+				Expect(metrics.GomenhashaiRegistryLookupDuration.WithLabelValues("other").(prometheus.Histogram).Write(duration)).To(Succeed())
+				Expect(duration.GetHistogram().GetSampleCount()).ToNot(BeZero())
+			})
+		})
+		Context("with expired entry", func() {
+			It("should query the registry again", func() {
+				helpers.CONFIG.RegistryCache.NegativeTTL = 0
+				_, err := helpers.GetDigestFromRegistry(repository.Tag("missing").String())
+				Expect(err).To(HaveOccurred())
+				_, err = helpers.GetDigestFromRegistry(repository.Tag("missing").String())
+				Expect(err).To(HaveOccurred())
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(2))
+			})
+		})
+		Context("with full cache", func() {
+			It("should evict the least recently used reference", func() {
+				helpers.CONFIG.RegistryCache.Size = 1
+				helpers.ResetRegistryCache()
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("v1").String())).To(Equal(digest))
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("v2").String())).ToNot(BeEmpty())
+				Expect(helpers.GetDigestFromRegistry(repository.Tag("v1").String())).To(Equal(digest))
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(3))
+			})
+		})
+		Context("with concurrent lookups", func() {
+			It("should query the registry once", func() {
+				var wg sync.WaitGroup
+				for range 5 {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						Expect(helpers.GetDigestFromRegistry(repository.Tag("v1").String())).To(Equal(digest))
+					}()
+				}
+				wg.Wait()
+				Expect(manifestRequests.Load()).To(BeEquivalentTo(1))
+			})
+		})
+	})
+})
@@ -0,0 +1,429 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Annotations set by cosign on the layers of signature images
+const (
+	CosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	CosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	CosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	CosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+)
+
+const cosignSignatureType = "cosign container image signature"
+
+// Maximum size of a signature payload read from the registry
+const maxSignaturePayloadSize = 1 << 20
+
+// Fulcio certificate extensions holding the OIDC issuer of the signer
+var (
+	fulcioIssuerOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+type SignatureVerificationConfig struct {
+	// Trust image digests carrying a valid cosign signature from one of the authorities
+	Enabled bool `yaml:"enabled"`
+	// Time to keep verification results in cache in seconds
+	CacheTTL int `yaml:"cacheTTL" validate:"gte=0"`
+	// Authorities trusted to sign images, first authority matching the image is used
+	Authorities []SignatureAuthority `yaml:"authorities" validate:"dive"`
+}
+
+type SignatureAuthority struct {
+	// Name of the authority used in logs and cache
+	Name string `yaml:"name" validate:"required"`
+	// Images signed by this authority, same format as exemptions ex: "regex:registry.corp/team/.*"
+	Images       []string       `yaml:"images" validate:"min=1"`
+	ImagesParsed []ImageMatcher `yaml:"-"`
+	// PEM public key used with cosign sign --key
+	PublicKey       string           `yaml:"publicKey" validate:"required_without=Keyless"`
+	PublicKeyParsed crypto.PublicKey `yaml:"-"`
+	// Keyless signatures using certificates issued by Fulcio
+	Keyless *KeylessAuthority `yaml:"keyless"`
+}
+
+type KeylessAuthority struct {
+	// PEM certificates of the Fulcio roots and intermediates
+	FulcioRoots     string         `yaml:"fulcioRoots" validate:"required"`
+	FulcioRootsPool *x509.CertPool `yaml:"-"`
+	// OIDC issuer of the signer identity
+	Issuer string `yaml:"issuer" validate:"required"`
+	// Signer identity, email or URI, can contain regex
+	Subject       string         `yaml:"subject" validate:"required"`
+	SubjectRegexp *regexp.Regexp `yaml:"-"`
+	// PEM public key of the Rekor log, signatures must have a Rekor bundle proving the certificate was valid when they were logged
+	RekorPublicKey       string           `yaml:"rekorPublicKey" validate:"required"`
+	RekorPublicKeyParsed crypto.PublicKey `yaml:"-"`
+}
+
+// Parse the keys of the authority
+func (a *SignatureAuthority) Prepare() error {
+	images, err := ParseImageMatchers(a.Images)
+	if err != nil {
+		return fmt.Errorf("invalid images: %w", err)
+	}
+	a.ImagesParsed = images
+	if a.PublicKey != "" {
+		key, err := parsePublicKey(a.PublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		a.PublicKeyParsed = key
+	}
+	if a.Keyless != nil {
+		a.Keyless.FulcioRootsPool = x509.NewCertPool()
+		if !a.Keyless.FulcioRootsPool.AppendCertsFromPEM([]byte(a.Keyless.FulcioRoots)) {
+			return fmt.Errorf("invalid fulcio roots: no certificate found")
+		}
+		subjectRegexp, err := regexp.Compile("^(?:" + a.Keyless.Subject + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid subject: %w", err)
+		}
+		a.Keyless.SubjectRegexp = subjectRegexp
+		// Fulcio certificates expire minutes after they are issued, only Rekor can tell they were valid at signature time
+		if a.Keyless.RekorPublicKey == "" {
+			return fmt.Errorf("rekor public key is required for keyless signatures")
+		}
+		key, err := parsePublicKey(a.Keyless.RekorPublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid rekor public key: %w", err)
+		}
+		a.Keyless.RekorPublicKeyParsed = key
+	}
+	return nil
+}
+
+func parsePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// Return the first authority signing this image or nil
+func GetSignatureAuthority(image string) *SignatureAuthority {
+	for i, authority := range CONFIG.SignatureVerification.Authorities {
+		if matchImage(authority.ImagesParsed, image) != nil {
+			return &CONFIG.SignatureVerification.Authorities[i]
+		}
+	}
+	return nil
+}
+
+var signatureCache = newLRUCache[bool](defaultConfig().RegistryCache.Size)
+var signatureCacheLock sync.RWMutex
+
+// Drop all cached verification results and apply the cache size from config
+func ResetSignatureCache() {
+	signatureCacheLock.Lock()
+	defer signatureCacheLock.Unlock()
+	signatureCache = newLRUCache[bool](CONFIG.RegistryCache.Size)
+}
+
+// Return the digest of the image in registry if it is signed by its authority or empty string
+func GetSignedDigest(image string) (string, error) {
+	if GetSignatureAuthority(image) == nil {
+		return "", nil
+	}
+	digest, err := GetDigestFromRegistry(image)
+	if err != nil {
+		return "", err
+	}
+	signed, err := VerifyImageSignature(image, digest)
+	if !signed {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Return if the digest of the image carries a valid cosign signature from the authority of the image
+func VerifyImageSignature(image string, digest string) (bool, error) {
+	authority := GetSignatureAuthority(image)
+	if authority == nil {
+		return false, nil
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse image reference: %v", err)
+	}
+	repository := ref.Context()
+
+	cacheKey := authority.Name + "|" + repository.Name() + "@" + digest
+	signatureCacheLock.RLock()
+	cache := signatureCache
+	signatureCacheLock.RUnlock()
+	if valid, ok := cache.Get(cacheKey); ok {
+		return valid, nil
+	}
+
+	valid, err := verifySignatures(authority, repository, digest)
+	// Registry errors are not cached so they are retried on next admission
+	if err != nil {
+		return false, err
+	}
+	cache.Set(cacheKey, valid, time.Duration(CONFIG.SignatureVerification.CacheTTL)*time.Second)
+	return valid, nil
+}
+
+// Fetch the signature image of the digest and return if one of its signatures is valid
+func verifySignatures(authority *SignatureAuthority, repository name.Repository, digest string) (bool, error) {
+	signatureTag := repository.Tag(strings.Replace(digest, ":", "-", 1) + ".sig")
+	signatureImage, err := remote.Image(signatureTag, registryOptions(repository.RegistryStr())...)
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get signature from registry: %v", err)
+	}
+	manifest, err := signatureImage.Manifest()
+	if err != nil {
+		return false, fmt.Errorf("failed to read signature manifest: %v", err)
+	}
+	for _, descriptor := range manifest.Layers {
+		signature, ok := descriptor.Annotations[CosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		layer, err := signatureImage.LayerByDigest(descriptor.Digest)
+		if err != nil {
+			return false, fmt.Errorf("failed to get signature layer: %v", err)
+		}
+		reader, err := layer.Compressed()
+		if err != nil {
+			return false, fmt.Errorf("failed to read signature layer: %v", err)
+		}
+		payload, err := io.ReadAll(io.LimitReader(reader, maxSignaturePayloadSize))
+		_ = reader.Close()
+		if err != nil {
+			return false, fmt.Errorf("failed to read signature layer: %v", err)
+		}
+		if verifySignature(authority, payload, signature, descriptor.Annotations, digest) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Return an error unless the payload is signed by the authority and targets the digest
+func verifySignature(authority *SignatureAuthority, payload []byte, signature string, annotations map[string]string, digest string) error {
+	rawSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	key := authority.PublicKeyParsed
+	if key == nil {
+		if authority.Keyless == nil {
+			return fmt.Errorf("authority has no key")
+		}
+		key, err = verifyKeyless(authority.Keyless, payload, signature, annotations)
+		if err != nil {
+			return err
+		}
+	}
+	if err := verifyWithKey(key, payload, rawSignature); err != nil {
+		return err
+	}
+
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+			Type string `json:"type"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if simpleSigning.Critical.Type != cosignSignatureType {
+		return fmt.Errorf("unexpected signature type %q", simpleSigning.Critical.Type)
+	}
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signature is for digest %s", simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+// Verify the Fulcio certificate of a keyless signature and return its public key
+func verifyKeyless(keyless *KeylessAuthority, payload []byte, signature string, annotations map[string]string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(annotations[CosignCertificateAnnotation]))
+	if block == nil {
+		return nil, fmt.Errorf("keyless signature without certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM([]byte(annotations[CosignChainAnnotation]))
+
+	// Certificates are short lived, they must be valid when the signature was logged in Rekor
+	integratedTime, err := verifyRekorBundle(keyless.RekorPublicKeyParsed, annotations[CosignBundleAnnotation], payload, signature)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         keyless.FulcioRootsPool,
+		Intermediates: intermediates,
+		CurrentTime:   integratedTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("untrusted certificate: %w", err)
+	}
+
+	if issuer := certificateIssuer(certificate); issuer != keyless.Issuer {
+		return nil, fmt.Errorf("certificate issuer %q does not match", issuer)
+	}
+	identities := certificate.EmailAddresses
+	for _, uri := range certificate.URIs {
+		identities = append(identities, uri.String())
+	}
+	for _, identity := range identities {
+		if keyless.SubjectRegexp.MatchString(identity) {
+			return certificate.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("certificate identities %v do not match", identities)
+}
+
+// Return the OIDC issuer stored by Fulcio in the certificate
+func certificateIssuer(certificate *x509.Certificate) string {
+	for _, extension := range certificate.Extensions {
+		if extension.Id.Equal(fulcioIssuerV2OID) {
+			var issuer string
+			if _, err := asn1.Unmarshal(extension.Value, &issuer); err == nil {
+				return issuer
+			}
+		}
+	}
+	for _, extension := range certificate.Extensions {
+		if extension.Id.Equal(fulcioIssuerOID) {
+			return string(extension.Value)
+		}
+	}
+	return ""
+}
+
+type rekorBundle struct {
+	SignedEntryTimestamp []byte       `json:"SignedEntryTimestamp"`
+	Payload              rekorPayload `json:"Payload"`
+}
+
+// Fields are in canonical JSON order as the signed entry timestamp covers the marshalled payload
+type rekorPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+type hashedRekord struct {
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content string `json:"content"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// Verify the Rekor bundle logs this signature and return the time it was logged
+func verifyRekorBundle(rekorKey crypto.PublicKey, bundleJSON string, payload []byte, signature string) (time.Time, error) {
+	if bundleJSON == "" {
+		return time.Time{}, fmt.Errorf("signature without rekor bundle")
+	}
+	var bundle rekorBundle
+	if err := json.Unmarshal([]byte(bundleJSON), &bundle); err != nil {
+		return time.Time{}, fmt.Errorf("invalid rekor bundle: %w", err)
+	}
+	canonicalPayload, err := json.Marshal(bundle.Payload)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid rekor bundle: %w", err)
+	}
+	if err := verifyWithKey(rekorKey, canonicalPayload, bundle.SignedEntryTimestamp); err != nil {
+		return time.Time{}, fmt.Errorf("invalid rekor signed entry timestamp: %w", err)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(bundle.Payload.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid rekor entry: %w", err)
+	}
+	var entry hashedRekord
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, fmt.Errorf("invalid rekor entry: %w", err)
+	}
+	payloadHash := sha256.Sum256(payload)
+	if entry.Spec.Signature.Content != signature || entry.Spec.Data.Hash.Value != hex.EncodeToString(payloadHash[:]) {
+		return time.Time{}, fmt.Errorf("rekor entry does not match the signature")
+	}
+	return time.Unix(bundle.Payload.IntegratedTime, 0), nil
+}
+
+// Verify the signature of the data with a public key
+func verifyWithKey(key crypto.PublicKey, data []byte, signature []byte) error {
+	hash := sha256.Sum256(data)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+const testIssuer = "https://oidc.test"
+const testSubject = "ci@corp.test"
+
+func publicKeyPEM(key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	Expect(err).NotTo(HaveOccurred())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signPayload(key *ecdsa.PrivateKey, payload []byte) string {
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	Expect(err).NotTo(HaveOccurred())
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func simpleSigningPayload(digest string) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"app"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, digest))
+}
+
+// Push the signature image of the digest as cosign does
+func pushSignature(repository name.Repository, digest string, payload []byte, annotations map[string]string) {
+	layer := static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json"))
+	signatureImage, err := mutate.Append(empty.Image, mutate.Addendum{Layer: layer, Annotations: annotations})
+	Expect(err).NotTo(HaveOccurred())
+	tag := repository.Tag(strings.Replace(digest, ":", "-", 1) + ".sig")
+	Expect(remote.Write(tag, signatureImage)).To(Succeed())
+}
+
+// Create a Fulcio like CA and a code signing certificate for the identity
+func issueCertificate(subject string, issuer string, notBefore time.Time) (*ecdsa.PrivateKey, string, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio.test"},
+		NotBefore:             notBefore.Add(-time.Hour),
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	caCert, err := x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	issuerValue, err := asn1.Marshal(issuer)
+	Expect(err).NotTo(HaveOccurred())
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      notBefore,
+		NotAfter:       notBefore.Add(10 * time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{subject},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuerValue},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	return key,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+}
+
+// Create a Rekor bundle logging the signature at the given time
+func rekorBundle(rekorKey *ecdsa.PrivateKey, payload []byte, signature string, certificate string, integratedTime time.Time) string {
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])}},
+			"signature": map[string]any{"content": signature, "publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString([]byte(certificate))}},
+		},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	entry := map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": integratedTime.Unix(),
+		"logID":          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+		"logIndex":       42,
+	}
+	canonical, err := json.Marshal(entry)
+	Expect(err).NotTo(HaveOccurred())
+	bundle, err := json.Marshal(map[string]any{
+		"SignedEntryTimestamp": signPayload(rekorKey, canonical),
+		"Payload":              entry,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	return string(bundle)
+}
+
+var _ = Describe("Signature", func() {
+	var server *httptest.Server
+	var repository name.Repository
+	var image string
+	var digest string
+	var signingKey *ecdsa.PrivateKey
+
+	BeforeEach(func() {
+		server = httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		var err error
+		repository, err = name.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/team/app")
+		Expect(err).NotTo(HaveOccurred())
+		image = repository.Tag("v1").String()
+
+		randomImage, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(repository.Tag("v1"), randomImage)).To(Succeed())
+		hash, err := randomImage.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		digest = hash.String()
+
+		signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		authority := helpers.SignatureAuthority{
+			Name:      "team",
+			Images:    []string{".*/team/.*"},
+			PublicKey: publicKeyPEM(signingKey),
+		}
+		Expect(authority.Prepare()).To(Succeed())
+		helpers.CONFIG.SignatureVerification = helpers.SignatureVerificationConfig{
+			Enabled:     true,
+			CacheTTL:    300,
+			Authorities: []helpers.SignatureAuthority{authority},
+		}
+		helpers.ResetSignatureCache()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		helpers.CONFIG.SignatureVerification = helpers.SignatureVerificationConfig{}
+		helpers.ResetSignatureCache()
+	})
+
+	// Test VerifyImageSignature()
+	Describe("Verify image signature with key", func() {
+		Context("with valid signature", func() {
+			It("should be trusted", func() {
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(signingKey, payload)})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+			})
+		})
+		Context("with signature from another key", func() {
+			It("should not be trusted", func() {
+				otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(otherKey, payload)})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("with signature of another digest", func() {
+			It("should not be trusted", func() {
+				payload := simpleSigningPayload("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(signingKey, payload)})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("without signature", func() {
+			It("should not be trusted", func() {
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("with image without authority", func() {
+			It("should not be trusted", func() {
+				Expect(helpers.VerifyImageSignature(repository.Registry.RegistryStr()+"/other/app:v1", digest)).To(BeFalse())
+			})
+		})
+		Context("with cached result", func() {
+			It("should not query the registry again", func() {
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(signingKey, payload)})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+				server.Close()
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+			})
+		})
+		Context("with more results than the cache size", func() {
+			It("should evict the least recently used result", func() {
+				previous := helpers.CONFIG.RegistryCache
+				helpers.CONFIG.RegistryCache.Size = 1
+				helpers.ResetSignatureCache()
+				defer func() {
+					helpers.CONFIG.RegistryCache = previous
+				}()
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(signingKey, payload)})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+				otherDigest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+				Expect(helpers.VerifyImageSignature(image, otherDigest)).To(BeFalse())
+				server.Close()
+				_, err := helpers.VerifyImageSignature(image, digest)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Verify image signature keyless", func() {
+		var certificateKey *ecdsa.PrivateKey
+		var certificate string
+		var rekorKey *ecdsa.PrivateKey
+		var signedAt time.Time
+
+		setKeyless := func(subject string, roots string, rekorPublicKey string) {
+			authority := helpers.SignatureAuthority{
+				Name:   "keyless",
+				Images: []string{".*/team/.*"},
+				Keyless: &helpers.KeylessAuthority{
+					FulcioRoots:    roots,
+					Issuer:         testIssuer,
+					Subject:        subject,
+					RekorPublicKey: rekorPublicKey,
+				},
+			}
+			Expect(authority.Prepare()).To(Succeed())
+			helpers.CONFIG.SignatureVerification.Authorities = []helpers.SignatureAuthority{authority}
+		}
+
+		BeforeEach(func() {
+			var roots string
+			signedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+			certificateKey, certificate, roots = issueCertificate(testSubject, testIssuer, signedAt)
+			var err error
+			rekorKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			setKeyless(".*@corp.test", roots, publicKeyPEM(rekorKey))
+		})
+
+		Context("with valid certificate and rekor bundle", func() {
+			It("should be trusted", func() {
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(rekorKey, payload, signature, certificate, signedAt.Add(time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+			})
+		})
+		Context("without rekor bundle", func() {
+			It("should not be trusted", func() {
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signPayload(certificateKey, payload),
+					helpers.CosignCertificateAnnotation: certificate,
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("with expired certificate logged in rekor while it was valid", func() {
+			It("should be trusted", func() {
+				Expect(signedAt.Add(10 * time.Minute)).To(BeTemporally("<", time.Now()))
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(rekorKey, payload, signature, certificate, signedAt.Add(5*time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeTrue())
+			})
+		})
+		Context("with expired certificate logged in rekor after it expired", func() {
+			It("should not be trusted", func() {
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(rekorKey, payload, signature, certificate, signedAt.Add(30*time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("without rekor public key", func() {
+			It("should be rejected by config", func() {
+				authority := helpers.SignatureAuthority{
+					Name:   "keyless",
+					Images: []string{".*/team/.*"},
+					Keyless: &helpers.KeylessAuthority{
+						FulcioRoots: helpers.CONFIG.SignatureVerification.Authorities[0].Keyless.FulcioRoots,
+						Issuer:      testIssuer,
+						Subject:     ".*@corp.test",
+					},
+				}
+				Expect(authority.Prepare()).To(MatchError(ContainSubstring("rekor public key is required")))
+			})
+		})
+		Context("with rekor bundle signed by another log", func() {
+			It("should not be trusted", func() {
+				otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(otherKey, payload, signature, certificate, signedAt.Add(time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("with another identity", func() {
+			It("should not be trusted", func() {
+				var roots string
+				certificateKey, certificate, roots = issueCertificate("intruder@evil.test", testIssuer, signedAt)
+				setKeyless(".*@corp.test", roots, publicKeyPEM(rekorKey))
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(rekorKey, payload, signature, certificate, signedAt.Add(time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+		Context("with certificate from another CA", func() {
+			It("should not be trusted", func() {
+				_, _, otherRoots := issueCertificate(testSubject, testIssuer, signedAt)
+				setKeyless(".*@corp.test", otherRoots, publicKeyPEM(rekorKey))
+				payload := simpleSigningPayload(digest)
+				signature := signPayload(certificateKey, payload)
+				pushSignature(repository, digest, payload, map[string]string{
+					helpers.CosignSignatureAnnotation:   signature,
+					helpers.CosignCertificateAnnotation: certificate,
+					helpers.CosignBundleAnnotation:      rekorBundle(rekorKey, payload, signature, certificate, signedAt.Add(time.Minute)),
+				})
+				Expect(helpers.VerifyImageSignature(image, digest)).To(BeFalse())
+			})
+		})
+	})
+
+	// Test GetTrustedDigests() with signatures
+	Describe("Get trusted digests with signature", func() {
+		Context("with signed image not in mapping", func() {
+			It("should trust the digest from registry", func() {
+				payload := simpleSigningPayload(digest)
+				pushSignature(repository, digest, payload, map[string]string{helpers.CosignSignatureAnnotation: signPayload(signingKey, payload)})
+				Expect(helpers.GetTrustedDigests(image)).To(Equal([]string{digest}))
+			})
+		})
+		Context("with unsigned image not in mapping", func() {
+			It("should not trust any digest", func() {
+				Expect(helpers.GetTrustedDigests(image)).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Sources of trusted digests that can be chained in trustSources
+const (
+	TrustSourceMapping   = "mapping"
+	TrustSourcePolicies  = "policies"
+	TrustSourceRegistry  = "registry"
+	TrustSourceSignature = "signature"
+	// Digests trusted only by the namespace policy, it cannot be set in trustSources
+	TrustSourceNamespacePolicy = "namespacePolicy"
+)
+
+// Return the trust sources in order, derived from fetchDigests, trustedDigestPolicies and signatureVerification when not configured
+func (c *Config) GetTrustSources() []string {
+	if len(c.TrustSources) > 0 {
+		return c.TrustSources
+	}
+	sources := []string{TrustSourceMapping}
+	if c.FetchDigests {
+		sources = []string{TrustSourceRegistry}
+	}
+	if c.TrustedDigestPolicies {
+		sources = append(sources, TrustSourcePolicies)
+	}
+	if c.SignatureVerification.Enabled {
+		sources = append(sources, TrustSourceSignature)
+	}
+	return sources
+}
+
+// Return if the trust source is part of the chain
+func (c *Config) UsesTrustSource(source string) bool {
+	return slices.Contains(c.GetTrustSources(), source)
+}
+
+// Return the digests trusted for the image by the first source of the chain that knows it and the name of this source.
+// The digest used by the container can be empty, when set signatures are verified for it instead of the digest in registry.
+// Errors of the sources are only returned when no source trusts any digest.
+func ResolveTrustedDigests(image string, digest string) ([]string, string, error) {
+	var errs []error
+	for _, source := range CONFIG.GetTrustSources() {
+		digests, err := getTrustSourceDigests(source, image, digest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		}
+		if len(digests) > 0 {
+			return digests, source, nil
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+func getTrustSourceDigests(source string, image string, digest string) ([]string, error) {
+	switch source {
+	case TrustSourceMapping:
+		return GetTrustedDigestsFromMapping(image), nil
+	case TrustSourcePolicies:
+		return GetTrustedDigestsFromPolicies(image), nil
+	case TrustSourceRegistry:
+		registryDigest, err := GetDigestFromRegistry(image)
+		if registryDigest == "" {
+			return nil, err
+		}
+		return []string{registryDigest}, err
+	case TrustSourceSignature:
+		if digest == "" {
+			signedDigest, err := GetSignedDigest(image)
+			if signedDigest == "" {
+				return nil, err
+			}
+			return []string{signedDigest}, nil
+		}
+		signed, err := VerifyImageSignature(image, digest)
+		if !signed {
+			return nil, err
+		}
+		return []string{digest}, nil
+	default:
+		return nil, fmt.Errorf("unknown trust source %q", source)
+	}
+}
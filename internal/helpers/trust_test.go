@@ -0,0 +1,138 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers_test
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+)
+
+var _ = Describe("Trust chain", func() {
+	var server *httptest.Server
+	var pinnedImage string
+	var otherImage string
+	var pinnedDigest string
+	var registryDigest string
+
+	BeforeEach(func() {
+		server = httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		repository, err := name.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/team/app")
+		Expect(err).NotTo(HaveOccurred())
+		for _, tag := range []string{"pinned", "other"} {
+			image, err := random.Image(256, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(repository.Tag(tag), image)).To(Succeed())
+			hash, err := image.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			registryDigest = hash.String()
+		}
+		pinnedImage = repository.Tag("pinned").String()
+		otherImage = repository.Tag("other").String()
+		pinnedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		helpers.DIGEST_MAPPING[pinnedImage] = helpers.DigestList{pinnedDigest}
+		helpers.ResetRegistryCache()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		delete(helpers.DIGEST_MAPPING, pinnedImage)
+		helpers.CONFIG.TrustSources = nil
+		helpers.ResetRegistryCache()
+	})
+
+	// Test GetTrustSources()
+	Describe("Get trust sources", func() {
+		Context("without trust sources", func() {
+			It("should use the mapping", func() {
+				Expect(helpers.CONFIG.GetTrustSources()).To(Equal([]string{helpers.TrustSourceMapping}))
+			})
+			It("should use the registry when fetching digests", func() {
+				config := helpers.Config{FetchDigests: true}
+				Expect(config.GetTrustSources()).To(Equal([]string{helpers.TrustSourceRegistry}))
+			})
+			It("should chain enabled sources after the registry", func() {
+				config := helpers.Config{FetchDigests: true, TrustedDigestPolicies: true, SignatureVerification: helpers.SignatureVerificationConfig{Enabled: true}}
+				Expect(config.GetTrustSources()).To(Equal([]string{helpers.TrustSourceRegistry, helpers.TrustSourcePolicies, helpers.TrustSourceSignature}))
+				Expect(config.UsesTrustSource(helpers.TrustSourcePolicies)).To(BeTrue())
+			})
+			It("should chain enabled sources after the mapping", func() {
+				config := helpers.Config{TrustedDigestPolicies: true, SignatureVerification: helpers.SignatureVerificationConfig{Enabled: true}}
+				Expect(config.GetTrustSources()).To(Equal([]string{helpers.TrustSourceMapping, helpers.TrustSourcePolicies, helpers.TrustSourceSignature}))
+			})
+		})
+	})
+
+	// Test ResolveTrustedDigests()
+	Describe("Resolve trusted digests", func() {
+		BeforeEach(func() {
+			helpers.CONFIG.TrustSources = []string{helpers.TrustSourceMapping, helpers.TrustSourceRegistry}
+		})
+		Context("with image in mapping", func() {
+			It("should keep the pinned digest", func() {
+				digests, source, err := helpers.ResolveTrustedDigests(pinnedImage, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(digests).To(Equal([]string{pinnedDigest}))
+				Expect(source).To(Equal(helpers.TrustSourceMapping))
+			})
+		})
+		Context("with image not in mapping", func() {
+			It("should fall back to the registry", func() {
+				digests, source, err := helpers.ResolveTrustedDigests(otherImage, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(digests).To(Equal([]string{registryDigest}))
+				Expect(source).To(Equal(helpers.TrustSourceRegistry))
+			})
+		})
+		Context("with registry first", func() {
+			It("should use the registry digest", func() {
+				helpers.CONFIG.TrustSources = []string{helpers.TrustSourceRegistry, helpers.TrustSourceMapping}
+				_, source, err := helpers.ResolveTrustedDigests(pinnedImage, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(source).To(Equal(helpers.TrustSourceRegistry))
+			})
+		})
+		Context("with image unknown to all sources", func() {
+			It("should return the errors of the sources", func() {
+				digests, source, err := helpers.ResolveTrustedDigests(strings.Replace(otherImage, ":other", ":missing", 1), "")
+				Expect(err).To(MatchError(ContainSubstring("registry:")))
+				Expect(digests).To(BeEmpty())
+				Expect(source).To(BeEmpty())
+			})
+		})
+		Context("with a failing source before a source knowing the image", func() {
+			It("should not return an error", func() {
+				helpers.CONFIG.TrustSources = []string{helpers.TrustSourceRegistry, helpers.TrustSourceMapping}
+				server.Close()
+				digests, source, err := helpers.ResolveTrustedDigests(pinnedImage, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(digests).To(Equal([]string{pinnedDigest}))
+				Expect(source).To(Equal(helpers.TrustSourceMapping))
+			})
+		})
+	})
+})
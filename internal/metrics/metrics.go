@@ -21,57 +21,203 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// Reasons of the decisions on containers images
+const (
+	ReasonNoDigest        = "no_digest"
+	ReasonInvalidDigest   = "invalid_digest"
+	ReasonUnknownImage    = "unknown_image"
+	ReasonUntrustedDigest = "untrusted_digest"
+	ReasonExempt          = "exempt"
+	ReasonRegistryError   = "registry_error"
+)
+
+// Labels of pods counters
+var podLabels = []string{"namespace", "operation"}
+
+// Labels of containers decisions counters, image is bucketed to bound cardinality
+var decisionLabels = []string{"namespace", "operation", "reason", "source", "image"}
+
 var (
-	GomenhashaiValidationTotal = prometheus.NewCounter(
+	GomenhashaiValidationTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_validation_total",
 			Help: "Number of pods processed by GomenHashai's validating webhook",
 		},
+		podLabels,
 	)
-	GomenhashaiMutationTotal = prometheus.NewCounter(
+	GomenhashaiMutationTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_mutation_total",
 			Help: "Number of pods processed by GomenHashai's mutation webhook",
 		},
+		podLabels,
 	)
-	GomenhashaiAllowed = prometheus.NewCounter(
+	GomenhashaiAllowed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_allowed_count",
 			Help: "Number of pods Allowed by GomenHashai",
 		},
+		podLabels,
 	)
-	GomenhashaiDenied = prometheus.NewCounter(
+	GomenhashaiDenied = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_denied_count",
-			Help: "Number of pods Denied by GomenHashai",
+			Help: "Number of containers Denied by GomenHashai, a pod with several untrusted containers counts once per container, by reason, trust source and image",
 		},
+		decisionLabels,
 	)
-	GomenhashaiWarnings = prometheus.NewCounter(
+	GomenhashaiWarnings = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_warnings_count",
-			Help: "Number of pods processed with Warnings by GomenHashai",
+			Help: "Number of containers reported with Warnings by GomenHashai, by reason, trust source and image",
+		},
+		decisionLabels,
+	)
+	GomenhashaiAudited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_audited_count",
+			Help: "Number of containers allowed silently in audit validation mode although they are not trusted, by reason, trust source and image",
 		},
+		decisionLabels,
 	)
-	GomenhashaiMutationExempted = prometheus.NewCounter(
+	GomenhashaiMutationExempted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_mutation_exempted_count",
-			Help: "Number of pods Exempted processed by GomenHashai during mutation",
+			Help: "Number of containers Exempted processed by GomenHashai during mutation",
 		},
+		decisionLabels,
 	)
-	GomenhashaiValidationExempted = prometheus.NewCounter(
+	GomenhashaiValidationExempted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_validation_exempted_count",
-			Help: "Number of pods Exempted processed by GomenHashai during validation",
+			Help: "Number of containers Exempted processed by GomenHashai during validation",
 		},
+		decisionLabels,
 	)
-	GomenhashaiDeleted = prometheus.NewCounter(
+	GomenhashaiDeleted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gomenhashai_deleted_count",
 			Help: "Number of pods Deleted by GomenHashai",
 		},
+		[]string{"namespace"},
+	)
+	GomenhashaiMappingReloaded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_mapping_reload_count",
+			Help: "Number of successful reloads of the digests mapping file",
+		},
+	)
+	GomenhashaiMappingReloadFailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_mapping_reload_failed_count",
+			Help: "Number of failed reloads of the digests mapping file, previous mapping is kept",
+		},
+	)
+	GomenhashaiTrustDecisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_trust_decision_count",
+			Help: "Number of containers images looked up in the trust chain by webhook and trust source that trusted them, none if no source did",
+		},
+		[]string{"webhook", "source"},
+	)
+	GomenhashaiExemptionHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_exemption_hit_count",
+			Help: "Number of containers images skipped by each exemption, by exemption list and exemption as written in config",
+		},
+		[]string{"list", "exemption"},
+	)
+	GomenhashaiBreakGlass = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_break_glass_count",
+			Help: "Number of break-glass uses, by namespace and result: allowed, rejected or evicted",
+		},
+		[]string{"namespace", "result"},
+	)
+	GomenhashaiPodsCompliant = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gomenhashai_pods_compliant",
+			Help: "Number of running pods whose images are all trusted or exempted at the last compliance scan, by namespace",
+		},
+		[]string{"namespace"},
+	)
+	GomenhashaiPodsNonCompliant = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gomenhashai_pods_noncompliant",
+			Help: "Number of running pods with images that are not trusted at the last compliance scan, by namespace and reason",
+		},
+		[]string{"namespace", "reason"},
+	)
+	GomenhashaiAuditDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_audit_dropped_count",
+			Help: "Number of audit records that could not be written, by sink: file, stdout or http",
+		},
+		[]string{"sink"},
+	)
+	GomenhashaiEnforcementWave = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gomenhashai_enforcement_wave",
+			Help: "Enforcement wave of every namespace, refreshed every minute by the leader: 1 when the wave denies untrusted pods, 0 before its start or when paused",
+		},
+		[]string{"namespace", "wave"},
+	)
+	GomenhashaiEventsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_events_dropped_count",
+			Help: "Number of Kubernetes events not emitted, by cause: rate or duplicate",
+		},
+		[]string{"cause"},
+	)
+	GomenhashaiMappingEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gomenhashai_mapping_entries",
+			Help: "Number of entries of the digests mapping in use",
+		},
+	)
+	GomenhashaiMutationDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gomenhashai_mutation_duration_seconds",
+			Help:    "Duration of the mutation of pods and workloads by GomenHashai's mutation webhook",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	GomenhashaiValidationDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gomenhashai_validation_duration_seconds",
+			Help:    "Duration of the validation of pods and workloads by GomenHashai's validating webhook",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	GomenhashaiRegistryLookupDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gomenhashai_registry_lookup_duration_seconds",
+			Help:    "Duration of the digests lookups sent to registries, by registry",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"registry"},
+	)
+	GomenhashaiRegistryErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_registry_error_count",
+			Help: "Number of failed digests lookups sent to registries, by registry and HTTP status class (4xx, 5xx) or other",
+		},
+		[]string{"registry", "status"},
+	)
+	GomenhashaiRegistryCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_registry_cache_hit_count",
+			Help: "Number of digests lookups served from the registry cache",
+		},
+	)
+	GomenhashaiRegistryCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gomenhashai_registry_cache_miss_count",
+			Help: "Number of digests lookups not found in the registry cache",
+		},
 	)
 )
 
 func Init() {
-	metrics.Registry.MustRegister(GomenhashaiValidationTotal, GomenhashaiMutationTotal, GomenhashaiAllowed, GomenhashaiDenied, GomenhashaiWarnings, GomenhashaiMutationExempted, GomenhashaiValidationExempted, GomenhashaiDeleted)
+	metrics.Registry.MustRegister(GomenhashaiValidationTotal, GomenhashaiMutationTotal, GomenhashaiAllowed, GomenhashaiDenied, GomenhashaiWarnings, GomenhashaiAudited, GomenhashaiMutationExempted, GomenhashaiValidationExempted, GomenhashaiDeleted, GomenhashaiMappingReloaded, GomenhashaiMappingReloadFailed, GomenhashaiTrustDecisions, GomenhashaiExemptionHits, GomenhashaiBreakGlass, GomenhashaiRegistryCacheHits, GomenhashaiRegistryCacheMisses, GomenhashaiMappingEntries, GomenhashaiMutationDuration, GomenhashaiValidationDuration, GomenhashaiRegistryLookupDuration, GomenhashaiRegistryErrors, GomenhashaiPodsCompliant, GomenhashaiPodsNonCompliant, GomenhashaiEventsDropped, GomenhashaiAuditDropped, GomenhashaiEnforcementWave)
 }
@@ -18,18 +18,27 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/GomenHashai/gomenhashai/internal/helpers"
 	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -37,8 +46,51 @@ import (
 
 var podlog = logf.Log.WithName("pod-resource")
 
-// SetupPodWebhookWithManager registers the webhook for Pod in the manager.
-func SetupPodWebhookWithManager(mgr ctrl.Manager) error {
+// podSpecOwner is the object holding a pod spec, used in errors and logs
+type podSpecOwner struct {
+	GroupResource schema.GroupResource
+	GroupKind     schema.GroupKind
+	Name          string
+	Namespace     string
+	// Labels of the pods created from the spec
+	Labels map[string]string
+	// Path of the pod spec in the object
+	SpecPath *field.Path
+	// Path of the pod template in workloads, nil for pods
+	TemplatePath *field.Path
+	Log          logr.Logger
+	// Object holding the spec, events are emitted on it
+	Object runtime.Object
+	// Controller of a pod being created, events of denials are emitted on it as the pod will not exist
+	Controller *corev1.ObjectReference
+	// The pod uses an authorized break-glass, digests are not injected so it runs the images it asks for
+	BreakGlass bool
+	// Names of the ephemeral containers of the pod before the update, they cannot be modified anymore
+	ExistingEphemeralContainers []string
+}
+
+// Return the object on which events about the spec are emitted, nil if the object cannot be referenced
+func (o podSpecOwner) eventTarget(denied bool) runtime.Object {
+	if o.Controller != nil && (denied || o.Name == "") {
+		return o.Controller
+	}
+	if o.Name == "" {
+		return nil
+	}
+	return o.Object
+}
+
+// Reader used to get namespaces labels to match namespace policies and exemption rules
+var namespaceReader client.Reader
+
+// Recorder of the events emitted on pods and workloads, no event is emitted when nil.
+// It is shared with the controllers so they all use the same rate limit.
+var eventRecorder record.EventRecorder
+
+// SetupPodWebhookWithManager registers the webhook for Pod in the manager, recorder emits the events of the webhooks.
+func SetupPodWebhookWithManager(mgr ctrl.Manager, recorder record.EventRecorder) error {
+	namespaceReader = mgr.GetClient()
+	eventRecorder = recorder
 	return ctrl.NewWebhookManagedBy(mgr).For(&corev1.Pod{}).
 		WithValidator(&PodCustomValidator{}).
 		WithDefaulter(&PodCustomDefaulter{}).
@@ -54,56 +106,292 @@ var _ webhook.CustomDefaulter = &PodCustomDefaulter{}
 
 // Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind Pod.
 func (d *PodCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	defer prometheus.NewTimer(metrics.GomenhashaiMutationDuration).ObserveDuration()
 	pod, ok := obj.(*corev1.Pod)
 
 	if !ok {
 		return fmt.Errorf("a wild exception appeared! GomenHashai is confused...😵 webhook expected a Pod object for the obj but got %T", obj)
 	}
 
-	podlog.Info("[🐾IntegrityPatrol] start mutation 🥷", "pod", pod.GetName())
+	owner := getPodOwner(pod)
+	oldPod := getOldPod(ctx)
+	owner.BreakGlass = authorizeBreakGlass(ctx, pod, oldPod).Used()
+	if oldPod != nil {
+		for _, container := range oldPod.Spec.EphemeralContainers {
+			owner.ExistingEphemeralContainers = append(owner.ExistingEphemeralContainers, container.Name)
+		}
+	}
+	// Only ephemeral containers can be modified through the ephemeralcontainers subresource
+	if isEphemeralContainersRequest(ctx) {
+		owner.Log.Info("[🐾IntegrityPatrol] start mutation of ephemeral containers 🥷")
+		scope := getPodScope(ctx, &pod.Spec, owner)
+		metrics.GomenhashaiMutationTotal.WithLabelValues(scope.Pod.Namespace, scope.Operation).Inc()
+		if owner.BreakGlass {
+			owner.Log.Info("[🐾IntegrityPatrol] break-glass used, skip digests injection 🚨")
+			scope.auditBreakGlass("mutation", &pod.Spec, owner.SpecPath, mutationMode())
+			return nil
+		}
+		pod.Spec.EphemeralContainers = addEphemeralContainerImageDigest(pod.Spec.EphemeralContainers, owner.ExistingEphemeralContainers, owner.Log, scope)
+		return nil
+	}
 
-	metrics.GomenhashaiMutationTotal.Inc()
+	defaultPodSpec(ctx, &pod.Spec, owner)
+	return nil
+}
 
-	pod.Spec.InitContainers = AddContainerImageDigest(pod.Spec.InitContainers, pod.GetName())
-	pod.Spec.Containers = AddContainerImageDigest(pod.Spec.Containers, pod.GetName())
+// Return the pod as owner of its own spec
+func getPodOwner(pod *corev1.Pod) podSpecOwner {
+	return podSpecOwner{
+		GroupResource: corev1.Resource("pods"),
+		GroupKind:     corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(),
+		Name:          pod.Name,
+		Namespace:     pod.GetNamespace(),
+		Labels:        pod.GetLabels(),
+		SpecPath:      field.NewPath("spec"),
+		Log:           podlog.WithValues("pod", pod.GetName()),
+		Object:        pod,
+	}
+}
+
+// Return the reference of the controller of the pod or nil
+func getPodController(pod *corev1.Pod) *corev1.ObjectReference {
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: controller.APIVersion,
+		Kind:       controller.Kind,
+		Name:       controller.Name,
+		Namespace:  pod.Namespace,
+		UID:        controller.UID,
+	}
+}
+
+// Return the pod before the update of the admission request or nil on create
+func getOldPod(ctx context.Context) *corev1.Pod {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil || len(req.OldObject.Raw) == 0 {
+		return nil
+	}
+	oldPod := &corev1.Pod{}
+	if err := json.Unmarshal(req.OldObject.Raw, oldPod); err != nil {
+		podlog.Error(err, "cannot decode the pod before the update 😥, GomenHashai...")
+		return nil
+	}
+	return oldPod
+}
+
+// Return if the admission request targets the ephemeralcontainers subresource of a pod (kubectl debug)
+func isEphemeralContainersRequest(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	return err == nil && req.SubResource == "ephemeralcontainers"
+}
+
+// Mutate images and pull secrets of the pod spec held by owner
+func defaultPodSpec(ctx context.Context, spec *corev1.PodSpec, owner podSpecOwner) {
+	log := owner.Log
+	log.Info("[🐾IntegrityPatrol] start mutation 🥷")
+
+	scope := getPodScope(ctx, spec, owner)
+
+	metrics.GomenhashaiMutationTotal.WithLabelValues(scope.Pod.Namespace, scope.Operation).Inc()
+
+	if owner.BreakGlass {
+		log.Info("[🐾IntegrityPatrol] break-glass used, skip digests injection 🚨")
+		scope.auditBreakGlass("mutation", spec, owner.SpecPath, mutationMode())
+	} else {
+		spec.InitContainers = addContainerImageDigest(spec.InitContainers, log, scope)
+		spec.Containers = addContainerImageDigest(spec.Containers, log, scope)
+		spec.EphemeralContainers = addEphemeralContainerImageDigest(spec.EphemeralContainers, owner.ExistingEphemeralContainers, log, scope)
+	}
 
 	// Do Image Pull Secrets mutation
 	if len(helpers.CONFIG.MutationImagePullSecrets) > 0 {
-		podlog.Info("[🐾IntegrityPatrol] add image pull secrets", "pod", pod.GetName(), "imagePullSecrets", helpers.CONFIG.MutationImagePullSecrets)
+		log.Info("[🐾IntegrityPatrol] add image pull secrets", "imagePullSecrets", helpers.CONFIG.MutationImagePullSecrets)
 		for _, pullSecret := range helpers.CONFIG.MutationImagePullSecrets {
 			secretName := pullSecret.Name
 			secretExists := false
-			for _, existingSecret := range pod.Spec.ImagePullSecrets {
+			for _, existingSecret := range spec.ImagePullSecrets {
 				if existingSecret.Name == secretName {
 					secretExists = true
 					break
 				}
 			}
 			if !secretExists {
-				pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+				spec.ImagePullSecrets = append(spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
 			}
 		}
-		podlog.Info("[🐾IntegrityPatrol] completed adding image pull secrets", "pod", pod.GetName(), "imagePullSecrets", helpers.CONFIG.MutationImagePullSecrets)
+		log.Info("[🐾IntegrityPatrol] completed adding image pull secrets", "imagePullSecrets", helpers.CONFIG.MutationImagePullSecrets)
 	}
+}
 
-	return nil
+// podScope holds the namespace policy and the pod attributes deciding which images are exempted
+type podScope struct {
+	// Namespace policy applying to the pod or nil to use global config
+	Policy *helpers.NamespacePolicy
+	Pod    helpers.PodContext
+	// Operation of the admission request used in metrics
+	Operation string
+	Log       logr.Logger
+	// Admission request and object holding the spec used in audit records
+	RequestUID string
+	User       string
+	Resource   string
+	Name       string
+	DryRun     bool
+	// Evaluation of a running pod outside of admission, exemption hits are not counted
+	Evaluation bool
 }
 
-// Loop container list and append digest to images, podName is used for logging
+// Return the namespace policy and pod attributes of the pod spec held by owner
+func getPodScope(ctx context.Context, spec *corev1.PodSpec, owner podSpecOwner) podScope {
+	scope := podScope{
+		Pod: helpers.PodContext{
+			Namespace:      owner.Namespace,
+			ServiceAccount: spec.ServiceAccountName,
+			Labels:         owner.Labels,
+		},
+		Operation: operationLabel(ctx),
+		Log:       owner.Log,
+		Resource:  owner.GroupResource.String(),
+		Name:      owner.Name,
+	}
+	if req, err := admission.RequestFromContext(ctx); err == nil {
+		scope.RequestUID = string(req.UID)
+		scope.User = req.UserInfo.Username
+		scope.DryRun = req.DryRun != nil && *req.DryRun
+	}
+	if owner.Namespace == "" || (len(helpers.CONFIG.NamespacePolicies) == 0 && len(helpers.CONFIG.ExemptionRules) == 0 && len(helpers.CONFIG.EnforcementWaves) == 0) {
+		return scope
+	}
+	if namespaceReader != nil && helpers.NamespaceSelectorsUsed() {
+		ns := &corev1.Namespace{}
+		if err := namespaceReader.Get(ctx, types.NamespacedName{Name: owner.Namespace}, ns); err != nil {
+			owner.Log.Error(err, "cannot get namespace labels to match namespace policies and exemption rules 😥, GomenHashai...", "namespace", owner.Namespace)
+		} else {
+			scope.Pod.NamespaceLabels = ns.Labels
+		}
+	}
+	scope.Policy = helpers.GetNamespacePolicy(owner.Namespace, scope.Pod.NamespaceLabels)
+	if scope.Policy != nil {
+		owner.Log.Info("[🐾IntegrityPatrol] namespace policy applies 📜", "namespace", owner.Namespace, "policy", scope.Policy.Name)
+	}
+	return scope
+}
+
+// Return the operation of the admission request as metric label, none outside of admission requests
+func operationLabel(ctx context.Context) string {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil || req.Operation == "" {
+		return "none"
+	}
+	return strings.ToLower(string(req.Operation))
+}
+
+// Return the labels of the metrics of a decision on the image of a container of the pod
+func (s podScope) decisionLabels(reason string, source string, image string) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace": s.Pod.Namespace,
+		"operation": s.Operation,
+		"reason":    reason,
+		"source":    trustSourceLabel(source),
+		"image":     helpers.ImageMetricLabel(image),
+	}
+}
+
+// Write the audit record of a decision of the webhook on the image of a container of the pod
+func (s podScope) audit(webhook string, container string, image string, record helpers.AuditRecord) {
+	if !helpers.AuditEnabled() {
+		return
+	}
+	record.Webhook = webhook
+	record.RequestUID = s.RequestUID
+	record.User = s.User
+	record.Operation = s.Operation
+	record.Namespace = s.Pod.Namespace
+	record.Resource = s.Resource
+	record.Name = s.Name
+	record.Container = container
+	record.OriginalImage = image
+	record.DryRun = s.DryRun
+	helpers.WriteAudit(record)
+}
+
+// Write the audit records of the containers of a pod spec skipped by the webhook as the pod uses a break-glass
+func (s podScope) auditBreakGlass(webhook string, spec *corev1.PodSpec, specPath *field.Path, mode string) {
+	for _, container := range podSpecContainers(spec, specPath) {
+		s.audit(webhook, container.Name, container.Image, helpers.AuditRecord{Verdict: helpers.AuditVerdictBreakGlass, Mode: mode})
+	}
+}
+
+// Return the mode of the mutation in audit records
+func mutationMode() string {
+	if helpers.CONFIG.MutationDryRun {
+		return "dryRun"
+	}
+	return "enforce"
+}
+
+// Return the validation mode of the pod: the one of the namespace policy, fail once the enforcement wave of the namespace started, or the global one
+func (s podScope) ValidationMode() string {
+	if s.Policy != nil && s.Policy.ValidationMode != "" {
+		return s.Policy.ValidationMode
+	}
+	if len(helpers.CONFIG.EnforcementWaves) > 0 && s.Pod.Namespace != "" {
+		if wave := helpers.GetEnforcementWave(s.Pod.Namespace, s.Pod.NamespaceLabels); wave != nil && wave.Enforced(time.Now()) {
+			s.Log.Info("[🐾IntegrityPatrol] enforcement wave applies 🌊", "namespace", s.Pod.Namespace, "wave", wave.Name)
+			return helpers.ValidationModeFail
+		}
+	}
+	return helpers.CONFIG.ValidationMode
+}
+
+// Return if the image is exempted globally, by the namespace policy or by an exemption rule matching the pod
+func (s podScope) IsImageExempt(image string) bool {
+	if s.Evaluation {
+		return s.Policy.MatchesExemption(image, false) || helpers.MatchExemptionRule(s.Pod, image) != nil
+	}
+	if s.Policy.IsImageExempt(image) {
+		return true
+	}
+	if rule := helpers.GetExemptionRule(s.Pod, image); rule != nil {
+		s.Log.Info("[🐾IntegrityPatrol] exemption rule applies 📜", "namespace", s.Pod.Namespace, "serviceAccount", s.Pod.ServiceAccount, "image", image, "rule", rule.Name)
+		return true
+	}
+	return false
+}
+
+// Return if the image of an ephemeral container is exempted, ephemeralContainerExemptions also applies
+func (s podScope) IsEphemeralImageExempt(image string) bool {
+	if s.Evaluation {
+		return s.Policy.MatchesExemption(image, true) || helpers.MatchExemptionRule(s.Pod, image) != nil
+	}
+	return s.IsImageExempt(image) || s.Policy.IsEphemeralImageExempt(image)
+}
+
+// Loop container list and append digest to images using global config, podName is used for logging
 func AddContainerImageDigest(inContainers []corev1.Container, podName string) []corev1.Container {
+	log := podlog.WithValues("pod", podName)
+	return addContainerImageDigest(inContainers, log, podScope{Operation: "none", Log: log})
+}
+
+func addContainerImageDigest(inContainers []corev1.Container, log logr.Logger, scope podScope) []corev1.Container {
 	containers := make([]corev1.Container, len(inContainers))
 	copy(containers, inContainers)
 	for i, container := range containers {
 		image := container.Image
-		if helpers.IsImageExempt(image) {
-			podlog.Info("[🐾IntegrityPatrol] skip exempted image ⛩️", "pod", podName, "container", container.Name, "image", container.Image)
-			metrics.GomenhashaiMutationExempted.Inc()
+		if scope.IsImageExempt(image) {
+			log.Info("[🐾IntegrityPatrol] skip exempted image ⛩️", "container", container.Name, "image", container.Image)
+			metrics.GomenhashaiMutationExempted.With(scope.decisionLabels(metrics.ReasonExempt, "", image)).Inc()
+			scope.audit("mutation", container.Name, image, helpers.AuditRecord{Verdict: helpers.AuditVerdictExempt, Reason: metrics.ReasonExempt, Mode: mutationMode()})
 			continue
 		}
+		originalImage := image
 
 		// Do registry mutation
 		if helpers.CONFIG.MutationRegistryEnabled {
-			podlog.Info("[🐾IntegrityPatrol] set common registry", "pod", podName, "container", container.Name, "image", container.Image, "registry", helpers.CONFIG.MutationRegistry)
+			log.Info("[🐾IntegrityPatrol] set common registry", "container", container.Name, "image", container.Image, "registry", helpers.CONFIG.MutationRegistry)
 			imageProcessRegistry := helpers.GetImageWithoutRegistry(image)
 			// If MutationRegistry is empty we already removed the registry
 			if helpers.CONFIG.MutationRegistry != "" {
@@ -116,26 +404,27 @@ func AddContainerImageDigest(inContainers []corev1.Container, podName string) []
 				containers[i] = container
 				image = imageProcessRegistry
 			}
-			podlog.Info("[🐾IntegrityPatrol] completed setting common registry", "pod", podName, "container", container.Name, "image", container.Image, "registry", helpers.CONFIG.MutationRegistry)
+			log.Info("[🐾IntegrityPatrol] completed setting common registry", "container", container.Name, "image", container.Image, "registry", helpers.CONFIG.MutationRegistry)
 		}
 
 		// Do Pull Policy mutation
 		if helpers.CONFIG.MutationPullPolicy != "" {
-			podlog.Info("[🐾IntegrityPatrol] set pull policy", "pod", podName, "container", container.Name, "pullPolicy", helpers.CONFIG.MutationPullPolicy)
+			log.Info("[🐾IntegrityPatrol] set pull policy", "container", container.Name, "pullPolicy", helpers.CONFIG.MutationPullPolicy)
 			container.ImagePullPolicy = corev1.PullPolicy(helpers.CONFIG.MutationPullPolicy)
 			containers[i] = container
-			podlog.Info("[🐾IntegrityPatrol] completed setting pull policy", "pod", podName, "container", container.Name, "pullPolicy", helpers.CONFIG.MutationPullPolicy)
+			log.Info("[🐾IntegrityPatrol] completed setting pull policy", "container", container.Name, "pullPolicy", helpers.CONFIG.MutationPullPolicy)
 		}
 
-		// Remove digest if already present in image field
-		digest := helpers.GetDigest(image)
-		if digest != "" {
-			image = strings.TrimSuffix(image, "@"+digest)
-		}
-		// Append digest from mapping or send error if no mapping
-		trustedDigest, err := helpers.GetTrustedDigest(image)
+		// Remove digest if already present in image field, even if it is not valid
+		image, _ = helpers.SplitImageDigest(image)
+		// Append digest from the trust chain or send error if no source trusts the image
+		trustedDigest, source, err := scope.Policy.ResolvePreferredDigest(image)
+		metrics.GomenhashaiTrustDecisions.WithLabelValues("mutation", trustSourceLabel(source)).Inc()
 		if err != nil {
-			podlog.Error(err, "something went wrong when getting trusted digest 😥, GomenHashai...", "pod", podName, "container", container.Name, "image", container.Image)
+			log.Error(err, "something went wrong when getting trusted digest 😥, GomenHashai...", "container", container.Name, "image", container.Image)
+			scope.audit("mutation", container.Name, originalImage, helpers.AuditRecord{
+				MutatedImage: container.Image, Source: source, Verdict: helpers.AuditVerdictError, Reason: metrics.ReasonRegistryError, Mode: mutationMode(),
+			})
 			continue
 		}
 		if trustedDigest != "" {
@@ -145,14 +434,47 @@ func AddContainerImageDigest(inContainers []corev1.Container, podName string) []
 				container.Image = image
 				containers[i] = container
 			}
-			podlog.Info("[🐾IntegrityPatrol] digest was added to image 🐶", "pod", podName, "container", container.Name, "image", container.Image, "digest", trustedDigest)
+			log.Info("[🐾IntegrityPatrol] digest was added to image 🐶", "container", container.Name, "image", container.Image, "digest", trustedDigest, "source", source)
+			scope.audit("mutation", container.Name, originalImage, helpers.AuditRecord{
+				MutatedImage: container.Image, TrustedDigest: trustedDigest, Source: source, Verdict: helpers.AuditVerdictMutated, Mode: mutationMode(),
+			})
 		} else {
-			podlog.Info("[🐾IntegrityPatrol] did not found any trusted digest for this image 🛡️", "pod", podName, "container", container.Name, "image", container.Image)
+			log.Info("[🐾IntegrityPatrol] did not found any trusted digest for this image 🛡️", "container", container.Name, "image", container.Image)
+			scope.audit("mutation", container.Name, originalImage, helpers.AuditRecord{
+				MutatedImage: container.Image, Verdict: helpers.AuditVerdictUnchanged, Reason: metrics.ReasonUnknownImage, Mode: mutationMode(),
+			})
 		}
 	}
 	return containers
 }
 
+// Append digest to images of ephemeral containers with the same rules as other containers, ephemeralContainerExemptions also applies.
+// Containers already in the pod before the update, listed in existing, are kept as they are.
+func addEphemeralContainerImageDigest(inContainers []corev1.EphemeralContainer, existing []string, log logr.Logger, scope podScope) []corev1.EphemeralContainer {
+	containers := make([]corev1.EphemeralContainer, len(inContainers))
+	copy(containers, inContainers)
+	for i, container := range containers {
+		// The API server rejects any change of an existing ephemeral container, even if the trusted digest changed since it was added
+		if slices.Contains(existing, container.Name) {
+			continue
+		}
+		if scope.IsEphemeralImageExempt(container.Image) {
+			log.Info("[🐾IntegrityPatrol] skip exempted ephemeral image ⛩️", "container", container.Name, "image", container.Image)
+			metrics.GomenhashaiMutationExempted.With(scope.decisionLabels(metrics.ReasonExempt, "", container.Image)).Inc()
+			scope.audit("mutation", container.Name, container.Image, helpers.AuditRecord{Verdict: helpers.AuditVerdictExempt, Reason: metrics.ReasonExempt, Mode: mutationMode()})
+			continue
+		}
+		mutated := addContainerImageDigest([]corev1.Container{{
+			Name:            container.Name,
+			Image:           container.Image,
+			ImagePullPolicy: container.ImagePullPolicy,
+		}}, log, scope)[0]
+		containers[i].Image = mutated.Image
+		containers[i].ImagePullPolicy = mutated.ImagePullPolicy
+	}
+	return containers
+}
+
 // PodCustomValidator struct is responsible for validating the Pod resource
 type PodCustomValidator struct {
 	// TODO(user): Add more fields as needed for validation
@@ -162,119 +484,328 @@ var _ webhook.CustomValidator = &PodCustomValidator{}
 
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Pod.
 func (v *PodCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return ValidatePod(obj)
+	return ValidatePod(ctx, obj)
 }
 
 // ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Pod.
 func (v *PodCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
-	return ValidatePod(newObj)
+	return validatePod(ctx, newObj, oldObj)
+}
+
+// Validate images of a pod being created
+func ValidatePod(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return validatePod(ctx, obj, nil)
 }
 
-func ValidatePod(obj runtime.Object) (admission.Warnings, error) {
+// Validate images of a pod, oldObj is the pod before the update or nil on create
+func validatePod(ctx context.Context, obj runtime.Object, oldObj runtime.Object) (admission.Warnings, error) {
+	defer prometheus.NewTimer(metrics.GomenhashaiValidationDuration).ObserveDuration()
 	pod, ok := obj.(*corev1.Pod)
 	if !ok {
 		return nil, fmt.Errorf("a wild exception appeared! GomenHashai is confused...😵 webhook expected a Pod object for the obj but got %T", obj)
 	}
-	podlog.Info("[🐾IntegrityPatrol] start in~spec~tion 🔍", "pod", pod.GetName())
+	oldPod, _ := oldObj.(*corev1.Pod)
+	owner := getPodOwner(pod)
+	if oldPod == nil {
+		owner.Controller = getPodController(pod)
+	}
+	allowed, warning := checkBreakGlass(ctx, pod, oldPod, owner.Log)
+	if allowed {
+		if helpers.AuditEnabled() {
+			scope := getPodScope(ctx, &pod.Spec, owner)
+			scope.auditBreakGlass("validation", &pod.Spec, owner.SpecPath, scope.ValidationMode())
+		}
+		return admission.Warnings{warning}, nil
+	}
+	warnings, err := validatePodSpec(ctx, &pod.Spec, owner)
+	if warning != "" {
+		warnings = append(admission.Warnings{warning}, warnings...)
+	}
+	return warnings, err
+}
 
-	metrics.GomenhashaiValidationTotal.Inc()
+// Result of the authorization of the break-glass of a pod for an admission request
+type breakGlassDecision struct {
+	// Break-glass requested by the pod, nil without break-glass or when its annotations are invalid
+	BreakGlass *helpers.BreakGlass
+	// The break-glass was authorized when it was set and the update changes neither it nor the containers
+	Unchanged bool
+	User      string
+	// Reason why the break-glass is rejected, nil when the pod skips the checks of its images
+	Err error
+}
 
-	warnings := admission.Warnings{}
+// Return if the decision lets the pod skip the checks of its images
+func (d breakGlassDecision) Used() bool {
+	return d.BreakGlass != nil && d.Err == nil
+}
 
-	containersList := append(pod.Spec.InitContainers, pod.Spec.Containers...)
-	for i, container := range containersList {
-		image := container.Image
-		if helpers.IsImageExempt(image) {
-			podlog.Info("[🐾IntegrityPatrol] skip exempted image ⛩️", "pod", pod.GetName(), "container", container.Name, "image", container.Image)
-			metrics.GomenhashaiValidationExempted.Inc()
-			continue
+// Authorize the break-glass of the pod for the request, oldPod is the pod before the update or nil on create.
+// A break-glass unchanged by an update was authorized when it was set, so only its expiry is checked
+// while the containers are unchanged too. Any other update is authorized again for the requesting user.
+func authorizeBreakGlass(ctx context.Context, pod *corev1.Pod, oldPod *corev1.Pod) breakGlassDecision {
+	breakGlass, err := helpers.GetBreakGlass(pod.Annotations)
+	decision := breakGlassDecision{BreakGlass: breakGlass, Err: err}
+	if breakGlass == nil {
+		return decision
+	}
+	now := time.Now()
+	if oldPod != nil &&
+		oldPod.Annotations[helpers.BreakGlassAnnotation] == pod.Annotations[helpers.BreakGlassAnnotation] &&
+		oldPod.Annotations[helpers.BreakGlassExpiryAnnotation] == pod.Annotations[helpers.BreakGlassExpiryAnnotation] &&
+		containersUnchanged(oldPod, pod) {
+		if helpers.CONFIG.BreakGlass.Enabled && !breakGlass.Expired(now) {
+			decision.Unchanged = true
+			return decision
 		}
+		decision.Err = fmt.Errorf("break-glass expired at %s", breakGlass.Expiry.Format(time.RFC3339))
+		return decision
+	}
+	var groups []string
+	if req, reqErr := admission.RequestFromContext(ctx); reqErr == nil {
+		decision.User = req.UserInfo.Username
+		groups = req.UserInfo.Groups
+	}
+	decision.Err = breakGlass.Authorize(groups, now)
+	return decision
+}
 
-		digest := helpers.GetDigest(image)
-		if digest == "" {
-			podlog.Info("[🍣GomenHashai!] a container tried to sneak in without using digest ❌", "pod", pod.GetName(), "container", container.Name, "image", image)
-			err := apierrors.NewForbidden(
-				schema.GroupResource{Group: pod.GroupVersionKind().Group, Resource: pod.Kind},
-				pod.Name,
-				field.Forbidden(
-					field.NewPath("spec").Child("containers").Index(i).Child("image"),
-					"image is not using a digest",
-				),
-			)
-			switch helpers.CONFIG.ValidationMode {
-			case helpers.ValidationModeFail:
-				metrics.GomenhashaiDenied.Inc()
-				return nil, err
-			case helpers.ValidationModeWarn:
-				warnings = append(warnings, err.Error())
-			default:
-				return nil, fmt.Errorf("🍣GomenHashai validationMode config is unknown: %v this should not append Please whisper sweet YAML to me and try again. original error: %v", helpers.CONFIG.ValidationMode, err)
-			}
+// Return if the pod skips validation with a break-glass and the warning to send to the user.
+func checkBreakGlass(ctx context.Context, pod *corev1.Pod, oldPod *corev1.Pod, log logr.Logger) (bool, string) {
+	decision := authorizeBreakGlass(ctx, pod, oldPod)
+	if decision.BreakGlass == nil && decision.Err == nil {
+		return false, ""
+	}
+	if decision.Err != nil {
+		log.Info("[🍣GomenHashai!] break-glass rejected, the pod is inspected as usual ❌", "user", decision.User, "reason", decision.Err.Error())
+		metrics.GomenhashaiBreakGlass.WithLabelValues(pod.Namespace, "rejected").Inc()
+		recordEvent(ctx, pod, corev1.EventTypeWarning, "BreakGlassRejected", "Break-glass rejected: %v", decision.Err)
+		return false, fmt.Sprintf("break-glass rejected: %v", decision.Err)
+	}
+	breakGlass := decision.BreakGlass
+	if decision.Unchanged {
+		log.Info("[🐾IntegrityPatrol] break-glass still valid, skip in~spec~tion 🚨", "reason", breakGlass.Reason, "expiry", breakGlass.Expiry)
+		return true, fmt.Sprintf("break-glass is used until %s: %s", breakGlass.Expiry.Format(time.RFC3339), breakGlass.Reason)
+	}
+	log.Info("[🍣GomenHashai!] break-glass used, skip in~spec~tion 🚨", "user", decision.User, "reason", breakGlass.Reason, "expiry", breakGlass.Expiry)
+	metrics.GomenhashaiBreakGlass.WithLabelValues(pod.Namespace, "allowed").Inc()
+	recordEvent(ctx, pod, corev1.EventTypeWarning, "BreakGlass", "Break-glass used by %s until %s: %s", decision.User, breakGlass.Expiry.Format(time.RFC3339), breakGlass.Reason)
+	return true, fmt.Sprintf("break-glass is used until %s: %s", breakGlass.Expiry.Format(time.RFC3339), breakGlass.Reason)
+}
+
+// Return if the update leaves the init, regular and ephemeral containers of the pod unchanged
+func containersUnchanged(oldPod *corev1.Pod, pod *corev1.Pod) bool {
+	return equality.Semantic.DeepEqual(oldPod.Spec.InitContainers, pod.Spec.InitContainers) &&
+		equality.Semantic.DeepEqual(oldPod.Spec.Containers, pod.Spec.Containers) &&
+		equality.Semantic.DeepEqual(oldPod.Spec.EphemeralContainers, pod.Spec.EphemeralContainers)
+}
+
+// Return if the admission request of the context is a dry-run, which must not have side effects
+func isDryRunRequest(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	return err == nil && req.DryRun != nil && *req.DryRun
+}
+
+// Emit an event on the object if a recorder is set and the request is not a dry-run
+func recordEvent(ctx context.Context, obj runtime.Object, eventType string, reason string, messageFmt string, args ...any) {
+	if eventRecorder != nil && obj != nil && !isDryRunRequest(ctx) {
+		eventRecorder.Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
+
+// Container image checked by the validation and the path of its image field
+type validatedContainer struct {
+	Name      string
+	Image     string
+	Path      *field.Path
+	Ephemeral bool
+}
+
+// Return the containers of the pod spec to validate with the paths of their images
+func podSpecContainers(spec *corev1.PodSpec, specPath *field.Path) []validatedContainer {
+	containersList := []validatedContainer{}
+	for i, container := range spec.InitContainers {
+		containersList = append(containersList, validatedContainer{
+			Name:  container.Name,
+			Image: container.Image,
+			Path:  specPath.Child("initContainers").Index(i).Child("image"),
+		})
+	}
+	for i, container := range spec.Containers {
+		containersList = append(containersList, validatedContainer{
+			Name:  container.Name,
+			Image: container.Image,
+			Path:  specPath.Child("containers").Index(i).Child("image"),
+		})
+	}
+	for i, container := range spec.EphemeralContainers {
+		containersList = append(containersList, validatedContainer{
+			Name:      container.Name,
+			Image:     container.Image,
+			Path:      specPath.Child("ephemeralContainers").Index(i).Child("image"),
+			Ephemeral: true,
+		})
+	}
+	return containersList
+}
+
+// Return the reasons why images of a running pod are not trusted with the current trust configuration, empty if the pod is compliant.
+// The pod is not mutated, nothing is logged and admission metrics and exemption hits are not counted.
+func EvaluatePod(ctx context.Context, pod *corev1.Pod) []string {
+	owner := getPodOwner(pod)
+	owner.Log = logr.Discard()
+	scope := getPodScope(ctx, &pod.Spec, owner)
+	scope.Evaluation = true
+	reasons := []string{}
+	for _, container := range podSpecContainers(&pod.Spec, owner.SpecPath) {
+		check := checkContainerImage(scope, container, owner.Log)
+		if check.Reason != "" && check.Reason != metrics.ReasonExempt && !slices.Contains(reasons, check.Reason) {
+			reasons = append(reasons, check.Reason)
 		}
-		podlog.Info("[🐾IntegrityPatrol] has found a digest ✨", "pod", pod.GetName(), "container", container.Name, "image", image, "digest", digest)
-		image = strings.TrimSuffix(image, "@"+digest)
-		// Get trusted digest
-		trustedDigest, err := helpers.GetTrustedDigest(image)
-		if err != nil {
-			podlog.Error(err, "something went wrong when getting trusted digest 😥, GomenHashai...", "pod", pod.GetName(), "container", container.Name, "image", container.Image)
+	}
+	return reasons
+}
+
+// Validate images of the pod spec held by owner
+func validatePodSpec(ctx context.Context, spec *corev1.PodSpec, owner podSpecOwner) (admission.Warnings, error) {
+	log := owner.Log
+	log.Info("[🐾IntegrityPatrol] start in~spec~tion 🔍")
+
+	warnings := admission.Warnings{}
+
+	scope := getPodScope(ctx, spec, owner)
+	metrics.GomenhashaiValidationTotal.WithLabelValues(scope.Pod.Namespace, scope.Operation).Inc()
+	validationMode := scope.ValidationMode()
+
+	// Violations of all containers are reported together so they can be fixed at once
+	violations := field.ErrorList{}
+	for _, container := range podSpecContainers(spec, owner.SpecPath) {
+		check := checkContainerImage(scope, container, log)
+		if check.Resolved {
+			metrics.GomenhashaiTrustDecisions.WithLabelValues("validation", trustSourceLabel(check.Source)).Inc()
 		}
-		// Check if image has a mapping with a trusted digest
-		if trustedDigest == "" {
-			podlog.Info("[🍣GomenHashai!] doesn't know any trusted digest for this image ❌", "pod", pod.GetName(), "container", container.Name, "image", image, "digest", digest)
-			err := apierrors.NewForbidden(
-				schema.GroupResource{Group: pod.GroupVersionKind().Group, Resource: pod.Kind},
-				pod.Name,
-				field.Forbidden(
-					field.NewPath("spec").Child("containers").Index(i).Child("image"),
-					"image does not have a trusted digest",
-				),
-			)
-			switch helpers.CONFIG.ValidationMode {
-			case helpers.ValidationModeFail:
-				metrics.GomenhashaiDenied.Inc()
-				return nil, err
-			case helpers.ValidationModeWarn:
-				warnings = append(warnings, err.Error())
-			default:
-				return nil, fmt.Errorf("🍣GomenHashai validationMode config is unknown: %v this should not append Please whisper sweet YAML to me and try again. original error: %v", helpers.CONFIG.ValidationMode, err)
-			}
+		switch check.Reason {
+		case "":
+			scope.audit("validation", container.Name, container.Image, helpers.AuditRecord{
+				TrustedDigest: check.Digest, Source: check.Source, Verdict: helpers.AuditVerdictAllowed, Mode: validationMode,
+			})
+			continue
+		case metrics.ReasonExempt:
+			metrics.GomenhashaiValidationExempted.With(scope.decisionLabels(check.Reason, "", container.Image)).Inc()
+			scope.audit("validation", container.Name, container.Image, helpers.AuditRecord{Verdict: helpers.AuditVerdictExempt, Reason: check.Reason, Mode: validationMode})
+			continue
 		}
-		// Check if the image is using the trusted digest
-		if trustedDigest != digest {
-			podlog.Info("[🍣GomenHashai!] digest is not trusted. Exile recommended ❌", "pod", pod.GetName(), "container", container.Name, "image", image, "digest", digest)
-			err := apierrors.NewForbidden(
-				schema.GroupResource{Group: pod.GroupVersionKind().Group, Resource: pod.Kind},
-				pod.Name,
-				field.Forbidden(
-					field.NewPath("spec").Child("containers").Index(i).Child("image"),
-					"image use an untrusted digest",
-				),
-			)
-			switch helpers.CONFIG.ValidationMode {
-			case helpers.ValidationModeFail:
-				metrics.GomenhashaiDenied.Inc()
-				return nil, err
-			case helpers.ValidationModeWarn:
-				warnings = append(warnings, err.Error())
-			default:
-				return nil, fmt.Errorf("🍣GomenHashai validationMode config is unknown: %v this should not append Please whisper sweet YAML to me and try again. original error: %v", helpers.CONFIG.ValidationMode, err)
-			}
-		} else {
-			podlog.Info("[🐾IntegrityPatrol] container-san image digest is trusted 🙇", "pod", pod.GetName(), "container", container.Name, "image", image, "digest", digest)
+		violation := field.Forbidden(container.Path, fmt.Sprintf("container %q: %s", container.Name, check.Message))
+		switch validationMode {
+		case helpers.ValidationModeFail:
+			metrics.GomenhashaiDenied.With(scope.decisionLabels(check.Reason, check.Source, check.Image)).Inc()
+			scope.audit("validation", container.Name, container.Image, helpers.AuditRecord{Source: check.Source, Verdict: helpers.AuditVerdictDenied, Reason: check.Reason, Mode: validationMode})
+			recordEvent(ctx, owner.eventTarget(true), corev1.EventTypeWarning, "ImageDenied", "Container %s image %s denied: %s (%s)", container.Name, container.Image, check.Message, check.Reason)
+		case helpers.ValidationModeWarn:
+			metrics.GomenhashaiWarnings.With(scope.decisionLabels(check.Reason, check.Source, check.Image)).Inc()
+			scope.audit("validation", container.Name, container.Image, helpers.AuditRecord{Source: check.Source, Verdict: helpers.AuditVerdictWarned, Reason: check.Reason, Mode: validationMode})
+			recordEvent(ctx, owner.eventTarget(false), corev1.EventTypeWarning, "ImageWarning", "Container %s image %s is not trusted: %s (%s)", container.Name, container.Image, check.Message, check.Reason)
+			warnings = append(warnings, violation.Error())
+		case helpers.ValidationModeAudit:
+			metrics.GomenhashaiAudited.With(scope.decisionLabels(check.Reason, check.Source, check.Image)).Inc()
+			scope.audit("validation", container.Name, container.Image, helpers.AuditRecord{Source: check.Source, Verdict: helpers.AuditVerdictAudited, Reason: check.Reason, Mode: validationMode})
+			recordEvent(ctx, owner.eventTarget(false), corev1.EventTypeWarning, "ImageAudited", "Container %s image %s is not trusted: %s (%s)", container.Name, container.Image, check.Message, check.Reason)
+			log.Info("[🐾IntegrityPatrol] untrusted image allowed silently in audit mode 📝", "container", container.Name, "image", container.Image, "reason", check.Reason)
+		default:
+			return nil, fmt.Errorf("🍣GomenHashai validationMode config is unknown: %v this should not append Please whisper sweet YAML to me and try again. original error: %v", validationMode, violation)
 		}
+		violations = append(violations, violation)
 	}
-	podlog.Info("[🍣GomenHashai] integrity verified. You may pass, pod-chan 💮 Okaeri~", "pod", pod.GetName())
-	podlog.Info("[🐾IntegrityPatrol] in~spec~tion complete ✅", "pod", pod.GetName())
-	if len(warnings) > 0 {
-		metrics.GomenhashaiWarnings.Inc()
-	} else {
-		metrics.GomenhashaiAllowed.Inc()
+	if len(violations) > 0 && validationMode == helpers.ValidationModeFail {
+		log.Info("[🍣GomenHashai!] in~spec~tion failed, the pod shall not pass ❌", "violations", len(violations))
+		return nil, apierrors.NewInvalid(owner.GroupKind, owner.Name, violations)
+	}
+	log.Info("[🍣GomenHashai] integrity verified. You may pass, pod-chan 💮 Okaeri~")
+	log.Info("[🐾IntegrityPatrol] in~spec~tion complete ✅")
+	if len(violations) == 0 {
+		metrics.GomenhashaiAllowed.WithLabelValues(scope.Pod.Namespace, scope.Operation).Inc()
 	}
 	return warnings, nil
 }
 
+// Result of the check of the image of a container, Reason is empty when the image is trusted
+type imageCheck struct {
+	Reason string
+	// Trust source that knew the image
+	Source string
+	// Image without digest and its digest
+	Image  string
+	Digest string
+	// Message of the violation
+	Message string
+	// The trust chain was used to check the image
+	Resolved bool
+}
+
+// Check the image of a container against exemptions and trusted digests of the scope
+func checkContainerImage(scope podScope, container validatedContainer, log logr.Logger) imageCheck {
+	image := container.Image
+	if (!container.Ephemeral && scope.IsImageExempt(image)) || (container.Ephemeral && scope.IsEphemeralImageExempt(image)) {
+		log.Info("[🐾IntegrityPatrol] skip exempted image ⛩️", "container", container.Name, "image", container.Image)
+		return imageCheck{Reason: metrics.ReasonExempt, Image: image}
+	}
+
+	image, digest := helpers.SplitImageDigest(image)
+	check := imageCheck{Image: image, Digest: digest}
+	if digest == "" {
+		log.Info("[🍣GomenHashai!] a container tried to sneak in without using digest ❌", "container", container.Name, "image", image)
+		check.Reason = metrics.ReasonNoDigest
+		check.Message = "image is not using a digest"
+		return check
+	}
+	if err := helpers.ValidateDigest(digest); err != nil {
+		log.Info("[🍣GomenHashai!] a container is using a digest that cannot be accepted ❌", "container", container.Name, "image", image, "digest", digest, "reason", err.Error())
+		check.Reason = metrics.ReasonInvalidDigest
+		check.Message = fmt.Sprintf("image digest is not accepted: %v", err)
+		return check
+	}
+	log.Info("[🐾IntegrityPatrol] has found a digest ✨", "container", container.Name, "image", image, "digest", digest)
+	// Get trusted digests
+	trustedDigests, source, err := scope.Policy.ResolveTrustedDigests(image, digest)
+	check.Source = source
+	check.Resolved = true
+	if err != nil {
+		log.Error(err, "something went wrong when getting trusted digest 😥, GomenHashai...", "container", container.Name, "image", container.Image)
+	}
+	if source != "" {
+		log.Info("[🐾IntegrityPatrol] trusted digests found 📜", "container", container.Name, "image", image, "source", source)
+	}
+	// Check if image has a mapping with a trusted digest
+	if len(trustedDigests) == 0 {
+		log.Info("[🍣GomenHashai!] doesn't know any trusted digest for this image ❌", "container", container.Name, "image", image, "digest", digest)
+		check.Reason = metrics.ReasonUnknownImage
+		if err != nil {
+			check.Reason = metrics.ReasonRegistryError
+		}
+		check.Message = "image does not have a trusted digest"
+		return check
+	}
+	// Check if the image is using one of the trusted digests
+	if !slices.Contains(trustedDigests, digest) {
+		log.Info("[🍣GomenHashai!] digest is not trusted. Exile recommended ❌", "container", container.Name, "image", image, "digest", digest)
+		check.Reason = metrics.ReasonUntrustedDigest
+		check.Message = "image use an untrusted digest"
+		return check
+	}
+	log.Info("[🐾IntegrityPatrol] container-san image digest is trusted 🙇", "container", container.Name, "image", image, "digest", digest)
+	return check
+}
+
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Pod.
 func (v *PodCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	// Do nothing on delete
 	return nil, nil
 }
+
+// Return the trust source as metric label
+func trustSourceLabel(source string) string {
+	if source == "" {
+		return "none"
+	}
+	return source
+}
@@ -18,14 +18,27 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
+	"time"
 
 	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var _ = Describe("Pod Webhook", func() {
@@ -113,7 +126,7 @@ var _ = Describe("Pod Webhook", func() {
 						Containers: mutatedContainers,
 					},
 				}
-				warn, err := ValidatePod(&pod)
+				warn, err := ValidatePod(context.TODO(), &pod)
 				Expect(warn).To(BeEmpty())
 				Expect(err).ToNot(HaveOccurred())
 			})
@@ -138,10 +151,10 @@ var _ = Describe("Pod Webhook", func() {
 						Containers: mutatedContainers,
 					},
 				}
-				warn, err := ValidatePod(&pod)
+				warn, err := ValidatePod(context.TODO(), &pod)
 				Expect(warn).To(BeEmpty())
 				Expect(err).To(HaveOccurred())
-				Expect(apierrors.IsForbidden(err)).To(BeTrue())
+				Expect(apierrors.IsInvalid(err)).To(BeTrue())
 			})
 		})
 		Context("Container using exempted images", func() {
@@ -160,7 +173,7 @@ var _ = Describe("Pod Webhook", func() {
 						Containers: mutatedContainers,
 					},
 				}
-				warn, err := ValidatePod(&pod)
+				warn, err := ValidatePod(context.TODO(), &pod)
 				Expect(warn).To(BeEmpty())
 				Expect(err).ToNot(HaveOccurred())
 			})
@@ -181,7 +194,7 @@ var _ = Describe("Pod Webhook", func() {
 						Containers: mutatedContainers,
 					},
 				}
-				warn, err := ValidatePod(&pod)
+				warn, err := ValidatePod(context.TODO(), &pod)
 				Expect(warn).To(BeEmpty())
 				Expect(err).ToNot(HaveOccurred())
 			})
@@ -474,7 +487,7 @@ var _ = Describe("Pod Webhook", func() {
 					Containers: mutatedContainers,
 				},
 			}
-			warn, err := ValidatePod(&pod)
+			warn, err := ValidatePod(context.TODO(), &pod)
 			Expect(warn).To(BeEmpty())
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -487,8 +500,8 @@ var _ = Describe("Pod Webhook", func() {
 					Containers: containersNotTrusted,
 				},
 			}
-			warn, err := ValidatePod(&pod)
-			Expect(warn).To(HaveEach(HavePrefix("forbidden:")))
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(HaveEach(ContainSubstring(".image: Forbidden:")))
 			Expect(err).ToNot(HaveOccurred())
 		})
 		AfterEach(func() {
@@ -497,6 +510,684 @@ var _ = Describe("Pod Webhook", func() {
 		})
 	})
 
+	Describe("Audit mode", func() {
+		var recorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeAudit
+			recorder = record.NewFakeRecorder(10)
+			eventRecorder = recorder
+		})
+		AfterEach(func() {
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeFail
+			eventRecorder = nil
+		})
+		It("Should allow not trusted containers without warnings but record the decision", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-audit"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			audited := &dto.Metric{}
+			Expect(metrics.GomenhashaiAudited.WithLabelValues("team-audit", "none", metrics.ReasonNoDigest, "none", helpers.UnmappedImageLabel).Write(audited)).To(Succeed())
+			before := audited.GetCounter().GetValue()
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(BeEmpty())
+			Expect(metrics.GomenhashaiAudited.WithLabelValues("team-audit", "none", metrics.ReasonNoDigest, "none", helpers.UnmappedImageLabel).Write(audited)).To(Succeed())
+			Expect(audited.GetCounter().GetValue()).To(Equal(before + 1))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning ImageAudited Container sidecar image curlimages/curl:7")))
+		})
+	})
+
+	Describe("Enforcement waves", func() {
+		BeforeEach(func() {
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeWarn
+			helpers.CONFIG.EnforcementWaves = []helpers.EnforcementWave{
+				{Name: "pilots", Start: "2025-01-01", Percentage: 100},
+				{Name: "later", Start: "2999-01-01"},
+			}
+			for i := range helpers.CONFIG.EnforcementWaves {
+				Expect(helpers.CONFIG.EnforcementWaves[i].Prepare()).To(Succeed())
+			}
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-wave"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+		})
+		AfterEach(func() {
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeFail
+			helpers.CONFIG.EnforcementWaves = nil
+			helpers.CONFIG.NamespacePolicies = nil
+		})
+		It("Should deny pods of namespaces in a started wave", func() {
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should warn in namespaces of a wave not started yet", func() {
+			helpers.CONFIG.EnforcementWaves = helpers.CONFIG.EnforcementWaves[1:]
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(1))
+		})
+		It("Should warn again when the wave is rolled back", func() {
+			helpers.CONFIG.EnforcementWaves[0].Paused = true
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(1))
+		})
+		It("Should use the validation mode of the namespace policy first", func() {
+			helpers.CONFIG.NamespacePolicies = []helpers.NamespacePolicy{{Name: "team-wave", Namespaces: []string{"team-wave"}, ValidationMode: helpers.ValidationModeWarn}}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(1))
+		})
+	})
+
+	Describe("Namespace policies", func() {
+		BeforeEach(func() {
+			helpers.CONFIG.NamespacePolicies = []helpers.NamespacePolicy{
+				{
+					Name:           "staging",
+					Namespaces:     []string{"staging"},
+					ValidationMode: helpers.ValidationModeWarn,
+				},
+				{
+					Name:       "team-curl",
+					Namespaces: []string{"team-curl"},
+					Exemptions: []string{"curlimages/curl:7"},
+					TrustedDigests: map[string]helpers.DigestList{
+						"myapp:stable": {"sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+					},
+				},
+			}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+		})
+		It("Should warn in namespace using warn mode", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "test",
+					Namespace: "staging",
+				},
+				Spec: corev1.PodSpec{
+					Containers: containersNotTrusted,
+				},
+			}
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(HaveEach(ContainSubstring(".image: Forbidden:")))
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should deny in namespace without policy", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "test",
+					Namespace: "production",
+				},
+				Spec: corev1.PodSpec{
+					Containers: containersNotTrusted,
+				},
+			}
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should apply namespace exemptions and trusted digests", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "test",
+					Namespace: "team-curl",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "app",
+							Image: "myapp:stable",
+						},
+						{
+							Name:  "sidecar",
+							Image: "curlimages/curl:7",
+						},
+					},
+				},
+			}
+			err := (&defaulter).Default(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Spec.Containers[0].Image).To(Equal("myapp:stable@sha256:1111111111111111111111111111111111111111111111111111111111111111"))
+			Expect(pod.Spec.Containers[1].Image).To(Equal("curlimages/curl:7"))
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should inject the newest digest of the mapping before the digests of the policy", func() {
+			digestNew := "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+			helpers.DIGEST_MAPPING["myapp:stable"] = helpers.DigestList{"sha256:2222222222222222222222222222222222222222222222222222222222222222", digestNew}
+			helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceNewest
+			defer func() {
+				delete(helpers.DIGEST_MAPPING, "myapp:stable")
+				helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceFirst
+			}()
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-curl"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "myapp:stable"}}},
+			}
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+			Expect(pod.Spec.Containers[0].Image).To(Equal("myapp:stable@" + digestNew))
+		})
+		AfterEach(func() {
+			helpers.CONFIG.NamespacePolicies = nil
+		})
+	})
+
+	Describe("Exemption rules", func() {
+		var restorePod func(serviceAccount string) corev1.Pod
+
+		BeforeEach(func() {
+			helpers.CONFIG.ExemptionRules = []helpers.ExemptionRule{
+				{
+					Name:            "velero-restore",
+					Namespaces:      []string{"velero"},
+					ServiceAccounts: []string{"velero"},
+					Images:          []string{"curlimages/curl:7"},
+				},
+				{
+					Name:              "sandbox",
+					NamespaceSelector: &v1.LabelSelector{MatchLabels: map[string]string{"env": "sandbox"}},
+				},
+				{
+					Name:        "canary",
+					PodSelector: &v1.LabelSelector{MatchLabels: map[string]string{"track": "canary"}},
+					Images:      []string{"glob:curlimages/*"},
+				},
+			}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+			restorePod = func(serviceAccount string) corev1.Pod {
+				return corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "restore",
+						Namespace: "velero",
+					},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: serviceAccount,
+						Containers:         containersNotTrusted[1:],
+					},
+				}
+			}
+		})
+		AfterEach(func() {
+			helpers.CONFIG.ExemptionRules = nil
+			namespaceReader = nil
+		})
+		It("Should exempt images of pods using the service account of the rule", func() {
+			pod = restorePod("velero")
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+			Expect(pod.Spec.Containers).To(Equal(containersNotTrusted[1:]))
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should deny the same image with another service account", func() {
+			pod = restorePod("")
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should exempt pods of namespaces matching the selector", func() {
+			namespaceReader = fake.NewClientBuilder().WithObjects(&corev1.Namespace{
+				ObjectMeta: v1.ObjectMeta{Name: "playground", Labels: map[string]string{"env": "sandbox"}},
+			}).Build()
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "playground"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted},
+			}
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+			pod.Namespace = "default"
+			_, err = ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should exempt pods matching the pod selector", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default", Labels: map[string]string{"track": "canary"}},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+			pod.Labels["track"] = "stable"
+			_, err = ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+	})
+
+	Describe("Break-glass", func() {
+		var previous helpers.BreakGlassConfig
+		var requestBy func(groups ...string) context.Context
+
+		BeforeEach(func() {
+			previous = helpers.CONFIG.BreakGlass
+			helpers.CONFIG.BreakGlass.Enabled = true
+			helpers.CONFIG.BreakGlass.Groups = []string{"oncall"}
+			helpers.CONFIG.BreakGlass.MaxDuration = 3600
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "hotfix",
+					Namespace: "default",
+					Annotations: map[string]string{
+						helpers.BreakGlassAnnotation:       "INC-1234",
+						helpers.BreakGlassExpiryAnnotation: time.Now().Add(30 * time.Minute).UTC().Format(time.RFC3339),
+					},
+				},
+				Spec: corev1.PodSpec{Containers: containersNotTrusted},
+			}
+			requestBy = func(groups ...string) context.Context {
+				return admission.NewContextWithRequest(context.Background(), admission.Request{
+					AdmissionRequest: admissionv1.AdmissionRequest{
+						Operation: admissionv1.Create,
+						UserInfo:  authenticationv1.UserInfo{Username: "jane", Groups: groups},
+					},
+				})
+			}
+		})
+		AfterEach(func() {
+			helpers.CONFIG.BreakGlass = previous
+		})
+		It("Should allow untrusted images for users of the groups", func() {
+			warn, err := ValidatePod(requestBy("oncall"), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(ConsistOf(ContainSubstring("break-glass is used until")))
+		})
+		It("Should validate as usual for other users", func() {
+			warn, err := ValidatePod(requestBy("developers"), &pod)
+			Expect(warn).To(ConsistOf(ContainSubstring("not in a break-glass group")))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should validate as usual when the expiry is too late", func() {
+			pod.Annotations[helpers.BreakGlassExpiryAnnotation] = time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)
+			_, err := ValidatePod(requestBy("oncall"), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should warn why the break-glass was rejected for trusted pods", func() {
+			delete(pod.Annotations, helpers.BreakGlassExpiryAnnotation)
+			pod.Spec.Containers = containersTrusted
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+			warn, err := ValidatePod(requestBy("oncall"), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(ConsistOf(ContainSubstring("break-glass rejected")))
+		})
+		It("Should allow updates keeping the break-glass until the expiry", func() {
+			oldPod := pod.DeepCopy()
+			warn, err := validator.ValidateUpdate(requestBy(), oldPod, &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(1))
+			pod.Annotations[helpers.BreakGlassExpiryAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+			oldPod = pod.DeepCopy()
+			_, err = validator.ValidateUpdate(requestBy(), oldPod, &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should not let updates add a break-glass without the groups", func() {
+			oldPod := pod.DeepCopy()
+			oldPod.Annotations = nil
+			_, err := validator.ValidateUpdate(requestBy("developers"), oldPod, &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should not inject trusted digests in pods using a break-glass", func() {
+			hotfix := "busybox@sha256:4444444444444444444444444444444444444444444444444444444444444444"
+			pod.Spec.Containers = []corev1.Container{{Name: "app", Image: hotfix}}
+			Expect((&defaulter).Default(requestBy("oncall"), &pod)).To(Succeed())
+			Expect(pod.Spec.Containers[0].Image).To(Equal(hotfix))
+			_, err := ValidatePod(requestBy("oncall"), &pod)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect((&defaulter).Default(requestBy("developers"), &pod)).To(Succeed())
+			Expect(pod.Spec.Containers[0].Image).ToNot(Equal(hotfix))
+		})
+		It("Should not let other users add untrusted ephemeral containers under a break-glass", func() {
+			oldPod := pod.DeepCopy()
+			pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "curlimages/curl:7"}},
+			}
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation:   admissionv1.Update,
+					SubResource: "ephemeralcontainers",
+					UserInfo:    authenticationv1.UserInfo{Username: "mallory", Groups: []string{"developers"}},
+				},
+			})
+			warn, err := validator.ValidateUpdate(ctx, oldPod, &pod)
+			Expect(warn).To(ContainElement(ContainSubstring("not in a break-glass group")))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.ephemeralContainers[0].image"))
+		})
+	})
+
+	Describe("Metrics labels", func() {
+		counterValue := func(counter *prometheus.CounterVec, labels ...string) float64 {
+			metric := &dto.Metric{}
+			Expect(counter.WithLabelValues(labels...).Write(metric)).To(Succeed())
+			return metric.GetCounter().GetValue()
+		}
+		var ctx context.Context
+
+		BeforeEach(func() {
+			ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create},
+			})
+		})
+		It("Should count denials by namespace, operation, reason and mapping key", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-metrics"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "busybox:stable"}}},
+			}
+			before := counterValue(metrics.GomenhashaiDenied, "team-metrics", "create", metrics.ReasonNoDigest, "none", "docker.io/library/busybox:stable")
+			_, err := ValidatePod(ctx, &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(counterValue(metrics.GomenhashaiDenied, "team-metrics", "create", metrics.ReasonNoDigest, "none", "docker.io/library/busybox:stable")).To(Equal(before + 1))
+		})
+		It("Should bucket images not in the mapping", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-metrics"},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:  "app",
+					Image: "ghcr.io/someone/random:1@sha256:1111111111111111111111111111111111111111111111111111111111111111",
+				}}},
+			}
+			before := counterValue(metrics.GomenhashaiDenied, "team-metrics", "create", metrics.ReasonUnknownImage, "none", helpers.UnmappedImageLabel)
+			_, err := ValidatePod(ctx, &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(counterValue(metrics.GomenhashaiDenied, "team-metrics", "create", metrics.ReasonUnknownImage, "none", helpers.UnmappedImageLabel)).To(Equal(before + 1))
+		})
+		It("Should count allowed pods by namespace and operation", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "team-metrics"},
+				Spec:       corev1.PodSpec{Containers: containersTrusted},
+			}
+			Expect((&defaulter).Default(ctx, &pod)).To(Succeed())
+			before := counterValue(metrics.GomenhashaiAllowed, "team-metrics", "create")
+			_, err := ValidatePod(ctx, &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(counterValue(metrics.GomenhashaiAllowed, "team-metrics", "create")).To(Equal(before + 1))
+		})
+	})
+
+	Describe("Compliance evaluation", func() {
+		It("Should report running pods with trusted or exempted images as compliant", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: append(containersTrusted, containersExempted...)},
+			}
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+			Expect(EvaluatePod(context.TODO(), &pod)).To(BeEmpty())
+		})
+		It("Should not count exemption hits", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: containersExempted},
+			}
+			hits := func() float64 {
+				metric := &dto.Metric{}
+				Expect(metrics.GomenhashaiExemptionHits.WithLabelValues("exemptions", ".*redis:.*").Write(metric)).To(Succeed())
+				return metric.GetCounter().GetValue()
+			}
+			before := hits()
+			Expect(EvaluatePod(context.TODO(), &pod)).To(BeEmpty())
+			Expect(hits()).To(Equal(before))
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hits()).To(Equal(before + 1))
+		})
+		It("Should report each reason once without mutating the pod", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "app", Image: "busybox:stable"},
+					{Name: "other", Image: "busybox:latest"},
+					{Name: "stale", Image: "busybox:stable@sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+				}},
+			}
+			original := pod.DeepCopy()
+			Expect(EvaluatePod(context.TODO(), &pod)).To(ConsistOf(metrics.ReasonNoDigest, metrics.ReasonUntrustedDigest))
+			Expect(pod).To(Equal(*original))
+		})
+	})
+
+	Describe("All violations", func() {
+		BeforeEach(func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", Image: "alpine:3.20"}},
+					Containers:     []corev1.Container{containersTrusted[0], containersNotTrusted[1]},
+					EphemeralContainers: []corev1.EphemeralContainer{{
+						EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "nicolaka/netshoot:v0.13"},
+					}},
+				},
+			}
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+		})
+		It("Should deny with every violation of the pod", func() {
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			status, ok := err.(apierrors.APIStatus)
+			Expect(ok).To(BeTrue())
+			Expect(status.Status().Details.Causes).To(HaveLen(3))
+			Expect(err.Error()).To(HavePrefix("Pod \"test\" is invalid: ["))
+		})
+		It("Should report each violation at the path of its container with its name", func() {
+			_, err := ValidatePod(context.TODO(), &pod)
+			status, ok := err.(apierrors.APIStatus)
+			Expect(ok).To(BeTrue())
+			Expect(status.Status().Details.Causes).To(ConsistOf(
+				And(HaveField("Field", "spec.initContainers[0].image"), HaveField("Message", ContainSubstring(`container "init"`))),
+				And(HaveField("Field", "spec.containers[1].image"), HaveField("Message", ContainSubstring(`container "sidecar"`))),
+				And(HaveField("Field", "spec.ephemeralContainers[0].image"), HaveField("Message", ContainSubstring(`container "debugger"`))),
+			))
+		})
+		It("Should not shift the index of containers by the number of init containers", func() {
+			pod.Spec.InitContainers = []corev1.Container{containersTrusted[0], containersTrusted[1]}
+			pod.Spec.Containers = []corev1.Container{{Name: "app", Image: "busybox"}}
+			pod.Spec.EphemeralContainers = nil
+			Expect((&defaulter).Default(context.TODO(), &pod)).To(Succeed())
+			pod.Spec.Containers[0].Image = "busybox"
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(Equal(`Pod "test" is invalid: spec.containers[0].image: Forbidden: container "app": image is not using a digest`))
+		})
+		It("Should warn with every violation of the pod", func() {
+			previous := helpers.CONFIG.ValidationMode
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeWarn
+			defer func() { helpers.CONFIG.ValidationMode = previous }()
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(3))
+		})
+	})
+
+	Describe("Events", func() {
+		var recorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+			recorder.IncludeObject = true
+			eventRecorder = recorder
+		})
+		AfterEach(func() {
+			eventRecorder = nil
+		})
+		It("Should emit a denial event on the controller of a pod being created", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "app-",
+					Namespace:    "default",
+					OwnerReferences: []v1.OwnerReference{{
+						APIVersion: "apps/v1",
+						Kind:       "ReplicaSet",
+						Name:       "app-5d8f",
+						Controller: ptr.To(true),
+					}},
+				},
+				Spec: corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(And(
+				HavePrefix("Warning ImageDenied Container sidecar image curlimages/curl:7 denied"),
+				ContainSubstring(metrics.ReasonNoDigest),
+				ContainSubstring("kind=ReplicaSet"),
+			)))
+		})
+		It("Should emit a warning event on the pod itself", func() {
+			previous := helpers.CONFIG.ValidationMode
+			helpers.CONFIG.ValidationMode = helpers.ValidationModeWarn
+			defer func() { helpers.CONFIG.ValidationMode = previous }()
+			pod = corev1.Pod{
+				TypeMeta:   v1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			warn, err := ValidatePod(context.TODO(), &pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warn).To(HaveLen(1))
+			Expect(recorder.Events).To(Receive(And(
+				HavePrefix("Warning ImageWarning Container sidecar image curlimages/curl:7 is not trusted"),
+				ContainSubstring("kind=Pod"),
+			)))
+		})
+		It("Should not emit events for dry-run requests", func() {
+			pod = corev1.Pod{
+				TypeMeta:   v1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update, DryRun: ptr.To(true)},
+			})
+			_, err := validator.ValidateUpdate(ctx, pod.DeepCopy(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+	})
+
+	Describe("Audit", func() {
+		var sink *auditCapture
+		ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				UID:       "1234",
+				Operation: admissionv1.Create,
+				UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			},
+		})
+
+		BeforeEach(func() {
+			sink = &auditCapture{}
+			helpers.SetAuditSinks(sink)
+		})
+		AfterEach(func() {
+			helpers.SetAuditSinks()
+		})
+		It("Should write a record for each container decision of the mutation and validation", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: append(containersNotTrusted, containersExempted...)},
+			}
+			Expect((&defaulter).Default(ctx, &pod)).To(Succeed())
+			Expect(sink.records).To(HaveLen(3))
+			mutated := sink.records[0]
+			Expect(mutated.Webhook).To(Equal("mutation"))
+			Expect(mutated.RequestUID).To(Equal("1234"))
+			Expect(mutated.User).To(Equal("jane"))
+			Expect(mutated.Operation).To(Equal("create"))
+			Expect(mutated.Namespace).To(Equal("default"))
+			Expect(mutated.Container).To(Equal("app"))
+			Expect(mutated.OriginalImage).To(Equal("busybox"))
+			Expect(mutated.MutatedImage).To(Equal(pod.Spec.Containers[0].Image))
+			Expect(mutated.TrustedDigest).To(Equal(helpers.GetDigest(pod.Spec.Containers[0].Image)))
+			Expect(mutated.Source).To(Equal(helpers.TrustSourceMapping))
+			Expect(mutated.Verdict).To(Equal(helpers.AuditVerdictMutated))
+			Expect(mutated.Mode).To(Equal("enforce"))
+			Expect(mutated.DryRun).To(BeFalse())
+			Expect(sink.records[1].Verdict).To(Equal(helpers.AuditVerdictUnchanged))
+			Expect(sink.records[2].Verdict).To(Equal(helpers.AuditVerdictExempt))
+
+			sink.records = nil
+			_, err := ValidatePod(ctx, &pod)
+			Expect(err).To(HaveOccurred())
+			Expect(sink.records).To(HaveLen(3))
+			Expect(sink.records[0].Webhook).To(Equal("validation"))
+			Expect(sink.records[0].Verdict).To(Equal(helpers.AuditVerdictAllowed))
+			Expect(sink.records[0].TrustedDigest).To(Equal(mutated.TrustedDigest))
+			Expect(sink.records[1].Verdict).To(Equal(helpers.AuditVerdictDenied))
+			Expect(sink.records[1].Reason).To(Equal(metrics.ReasonNoDigest))
+			Expect(sink.records[1].Mode).To(Equal(helpers.ValidationModeFail))
+			Expect(sink.records[2].Verdict).To(Equal(helpers.AuditVerdictExempt))
+		})
+		It("Should mark the records of dry-run requests", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: containersNotTrusted[1:]},
+			}
+			dryRunCtx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update, DryRun: ptr.To(true)},
+			})
+			_, err := validator.ValidateUpdate(dryRunCtx, pod.DeepCopy(), &pod)
+			Expect(err).To(HaveOccurred())
+			Expect(sink.records).To(HaveLen(1))
+			Expect(sink.records[0].Verdict).To(Equal(helpers.AuditVerdictDenied))
+			Expect(sink.records[0].DryRun).To(BeTrue())
+		})
+	})
+
+	Describe("Multiple trusted digests", func() {
+		var digestOld string
+		var digestNew string
+
+		BeforeEach(func() {
+			digestOld = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+			digestNew = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+			helpers.DIGEST_MAPPING["myapp:stable"] = helpers.DigestList{digestOld, digestNew}
+		})
+		AfterEach(func() {
+			delete(helpers.DIGEST_MAPPING, "myapp:stable")
+			helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceFirst
+		})
+		It("Should inject the first digest by default", func() {
+			mutatedContainers = AddContainerImageDigest([]corev1.Container{{Name: "app", Image: "myapp:stable"}}, "test")
+			Expect(mutatedContainers[0].Image).To(Equal("myapp:stable@" + digestOld))
+		})
+		It("Should inject the newest digest with newest preference", func() {
+			helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceNewest
+			mutatedContainers = AddContainerImageDigest([]corev1.Container{{Name: "app", Image: "myapp:stable"}}, "test")
+			Expect(mutatedContainers[0].Image).To(Equal("myapp:stable@" + digestNew))
+		})
+		It("Should allow any of the digests", func() {
+			for _, digest := range []string{digestOld, digestNew} {
+				pod = corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{
+						Name: "test",
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "app", Image: "myapp:stable@" + digest}},
+					},
+				}
+				warn, err := ValidatePod(context.TODO(), &pod)
+				Expect(warn).To(BeEmpty())
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+		It("Should deny a digest not in the list", func() {
+			pod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "myapp:stable@sha256:3333333333333333333333333333333333333333333333333333333333333333"}},
+				},
+			}
+			_, err := ValidatePod(context.TODO(), &pod)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+	})
+
 	Describe("On trusted pod update", func() {
 		BeforeEach(func() {
 			pod = corev1.Pod{
@@ -560,14 +1251,14 @@ var _ = Describe("Pod Webhook", func() {
 		It("On Create Should deny the pod", func() {
 			tmpPod := pod.DeepCopy()
 			warn, err := (&validator).ValidateCreate(context.TODO(), tmpPod)
-			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
 			Expect(warn).To(BeEmpty())
 			Expect(*tmpPod).To(Equal(pod))
 		})
 		It("On Update Should deny the pod", func() {
 			tmpPod := pod.DeepCopy()
 			warn, err := (&validator).ValidateUpdate(context.TODO(), nil, tmpPod)
-			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
 			Expect(warn).To(BeEmpty())
 			Expect(*tmpPod).To(Equal(pod))
 		})
@@ -579,4 +1270,147 @@ var _ = Describe("Pod Webhook", func() {
 			Expect(*tmpPod).To(Equal(pod))
 		})
 	})
+	Describe("Ephemeral containers", func() {
+		var ephemeralPod corev1.Pod
+
+		BeforeEach(func() {
+			ephemeralPod = corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: corev1.PodSpec{
+					Containers: containersNotTrusted[:1],
+					EphemeralContainers: []corev1.EphemeralContainer{
+						{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "busybox:stable"}},
+						{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "curl", Image: "curlimages/curl:7"}},
+					},
+				},
+			}
+		})
+		AfterEach(func() {
+			helpers.CONFIG.EphemeralContainerExemptions = []string{}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+		})
+		It("Should add trusted digests to ephemeral containers", func() {
+			Expect((&defaulter).Default(context.TODO(), &ephemeralPod)).To(Succeed())
+			digest, err := helpers.GetTrustedDigest("busybox:stable")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.GetDigest(ephemeralPod.Spec.EphemeralContainers[0].Image)).To(Equal(digest))
+			Expect(helpers.GetDigest(ephemeralPod.Spec.EphemeralContainers[1].Image)).To(BeEmpty())
+		})
+		It("Should only mutate ephemeral containers on the ephemeralcontainers subresource", func() {
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{SubResource: "ephemeralcontainers"},
+			})
+			Expect((&defaulter).Default(ctx, &ephemeralPod)).To(Succeed())
+			Expect(ephemeralPod.Spec.Containers[0].Image).To(Equal("busybox"))
+			Expect(helpers.GetDigest(ephemeralPod.Spec.EphemeralContainers[0].Image)).ToNot(BeEmpty())
+		})
+		It("Should not mutate ephemeral containers added before the mapping changed", func() {
+			oldDigest := "sha256:5555555555555555555555555555555555555555555555555555555555555555"
+			newDigest := "sha256:6666666666666666666666666666666666666666666666666666666666666666"
+			helpers.DIGEST_MAPPING["debugtools:1"] = helpers.DigestList{oldDigest}
+			defer func() {
+				delete(helpers.DIGEST_MAPPING, "debugtools:1")
+				helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceFirst
+			}()
+			ephemeralPod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "debugtools:1"}},
+			}
+			Expect((&defaulter).Default(context.TODO(), &ephemeralPod)).To(Succeed())
+			Expect(ephemeralPod.Spec.EphemeralContainers[0].Image).To(Equal("debugtools:1@" + oldDigest))
+
+			// A new digest is trusted and preferred once the first debug container runs
+			helpers.DIGEST_MAPPING["debugtools:1"] = helpers.DigestList{oldDigest, newDigest}
+			helpers.CONFIG.MutationDigestPreference = helpers.DigestPreferenceNewest
+			oldPod, err := json.Marshal(ephemeralPod)
+			Expect(err).ToNot(HaveOccurred())
+			ephemeralPod.Spec.EphemeralContainers = append(ephemeralPod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger-2", Image: "debugtools:1"},
+			})
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation:   admissionv1.Update,
+					SubResource: "ephemeralcontainers",
+					OldObject:   runtime.RawExtension{Raw: oldPod},
+				},
+			})
+			Expect((&defaulter).Default(ctx, &ephemeralPod)).To(Succeed())
+			Expect(ephemeralPod.Spec.EphemeralContainers[0].Image).To(Equal("debugtools:1@" + oldDigest))
+			Expect(ephemeralPod.Spec.EphemeralContainers[1].Image).To(Equal("debugtools:1@" + newDigest))
+		})
+		It("Should deny untrusted ephemeral containers with their path", func() {
+			Expect((&defaulter).Default(context.TODO(), &ephemeralPod)).To(Succeed())
+			warn, err := (&validator).ValidateUpdate(context.TODO(), nil, &ephemeralPod)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.ephemeralContainers[1].image"))
+		})
+		It("Should skip ephemeral containers exempted separately", func() {
+			helpers.CONFIG.EphemeralContainerExemptions = []string{"curlimages/.*"}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+			Expect((&defaulter).Default(context.TODO(), &ephemeralPod)).To(Succeed())
+			Expect(ephemeralPod.Spec.EphemeralContainers[1].Image).To(Equal("curlimages/curl:7"))
+			warn, err := (&validator).ValidateUpdate(context.TODO(), nil, &ephemeralPod)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should not exempt other containers with ephemeral exemptions", func() {
+			helpers.CONFIG.EphemeralContainerExemptions = []string{".*"}
+			Expect(helpers.CONFIG.PrepareExemptions()).To(Succeed())
+			ephemeralPod.Spec.Containers = containersNotTrusted[1:]
+			warn, err := (&validator).ValidateUpdate(context.TODO(), nil, &ephemeralPod)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.containers[0].image"))
+		})
+	})
+	Describe("Digest algorithms", func() {
+		sha512Digest := "sha512:" + strings.Repeat("ab", 64)
+		BeforeEach(func() {
+			helpers.DIGEST_MAPPING["alpine:3"] = helpers.DigestList{sha512Digest}
+		})
+		AfterEach(func() {
+			delete(helpers.DIGEST_MAPPING, "alpine:3")
+			helpers.CONFIG.DigestAlgorithms = []string{"sha256", "sha512"}
+		})
+		It("Should keep a single sha512 digest and allow it", func() {
+			containers := AddContainerImageDigest([]corev1.Container{{Name: "app", Image: "alpine:3@" + sha512Digest}}, "test")
+			Expect(containers[0].Image).To(Equal("alpine:3@" + sha512Digest))
+			warn, err := ValidatePod(context.TODO(), &corev1.Pod{Spec: corev1.PodSpec{Containers: containers}})
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should replace a digest with an unknown algorithm", func() {
+			containers := AddContainerImageDigest([]corev1.Container{{Name: "app", Image: "alpine:3@md5:abcd"}}, "test")
+			Expect(containers[0].Image).To(Equal("alpine:3@" + sha512Digest))
+		})
+		It("Should deny digests with an algorithm not allowed", func() {
+			helpers.CONFIG.DigestAlgorithms = []string{"sha256"}
+			warn, err := ValidatePod(context.TODO(), &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "alpine:3@" + sha512Digest}}}})
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("not allowed"))
+		})
+		It("Should deny invalid digests", func() {
+			warn, err := ValidatePod(context.TODO(), &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "alpine:3@sha512:abcd"}}}})
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("image digest is not accepted"))
+		})
+	})
 })
+
+// auditCapture keeps audit records in memory
+type auditCapture struct {
+	records []helpers.AuditRecord
+}
+
+func (c *auditCapture) Write(record helpers.AuditRecord) error {
+	c.records = append(c.records, record)
+	return nil
+}
+
+func (c *auditCapture) Close() error {
+	return nil
+}
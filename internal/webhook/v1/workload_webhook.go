@@ -0,0 +1,205 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	"github.com/GomenHashai/gomenhashai/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var workloadlog = logf.Log.WithName("workload-resource")
+
+// Workload kinds whose pod template is checked at admission
+var workloadObjects = []client.Object{
+	&appsv1.Deployment{},
+	&appsv1.StatefulSet{},
+	&appsv1.DaemonSet{},
+	&batchv1.Job{},
+	&batchv1.CronJob{},
+}
+
+// SetupWorkloadWebhooksWithManager registers the webhooks for the pod templates of workloads in the manager, recorder emits the events of the webhooks.
+func SetupWorkloadWebhooksWithManager(mgr ctrl.Manager, recorder record.EventRecorder) error {
+	namespaceReader = mgr.GetClient()
+	eventRecorder = recorder
+	for _, obj := range workloadObjects {
+		if err := ctrl.NewWebhookManagedBy(mgr).For(obj).
+			WithValidator(&WorkloadCustomValidator{}).
+			WithDefaulter(&WorkloadCustomDefaulter{}).
+			Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the pod template of the workload and the owner of its pod spec
+func getWorkloadPodTemplate(obj runtime.Object) (*corev1.PodTemplateSpec, podSpecOwner, error) {
+	var template *corev1.PodTemplateSpec
+	var templatePath *field.Path
+	var groupResource schema.GroupResource
+	var groupKind schema.GroupKind
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		template = &workload.Spec.Template
+		templatePath = field.NewPath("spec", "template")
+		groupResource = appsv1.Resource("deployments")
+		groupKind = appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind()
+	case *appsv1.StatefulSet:
+		template = &workload.Spec.Template
+		templatePath = field.NewPath("spec", "template")
+		groupResource = appsv1.Resource("statefulsets")
+		groupKind = appsv1.SchemeGroupVersion.WithKind("StatefulSet").GroupKind()
+	case *appsv1.DaemonSet:
+		template = &workload.Spec.Template
+		templatePath = field.NewPath("spec", "template")
+		groupResource = appsv1.Resource("daemonsets")
+		groupKind = appsv1.SchemeGroupVersion.WithKind("DaemonSet").GroupKind()
+	case *batchv1.Job:
+		template = &workload.Spec.Template
+		templatePath = field.NewPath("spec", "template")
+		groupResource = batchv1.Resource("jobs")
+		groupKind = batchv1.SchemeGroupVersion.WithKind("Job").GroupKind()
+	case *batchv1.CronJob:
+		template = &workload.Spec.JobTemplate.Spec.Template
+		templatePath = field.NewPath("spec", "jobTemplate", "spec", "template")
+		groupResource = batchv1.Resource("cronjobs")
+		groupKind = batchv1.SchemeGroupVersion.WithKind("CronJob").GroupKind()
+	default:
+		return nil, podSpecOwner{}, fmt.Errorf("a wild exception appeared! GomenHashai is confused...😵 webhook expected a workload object for the obj but got %T", obj)
+	}
+	meta := obj.(metav1.Object)
+	return template, podSpecOwner{
+		GroupResource: groupResource,
+		GroupKind:     groupKind,
+		Name:          meta.GetName(),
+		Namespace:     meta.GetNamespace(),
+		Labels:        template.GetLabels(),
+		SpecPath:      templatePath.Child("spec"),
+		TemplatePath:  templatePath,
+		Log:           workloadlog.WithValues("resource", groupResource.String(), "name", meta.GetName()),
+		Object:        obj,
+	}, nil
+}
+
+// WorkloadCustomDefaulter mutates the pod templates of workloads
+type WorkloadCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &WorkloadCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the workload kinds.
+func (d *WorkloadCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	defer prometheus.NewTimer(metrics.GomenhashaiMutationDuration).ObserveDuration()
+	template, owner, err := getWorkloadPodTemplate(obj)
+	if err != nil {
+		return err
+	}
+	// The pod template of a Job cannot be modified once created
+	if _, isJob := obj.(*batchv1.Job); isJob {
+		if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation == admissionv1.Update {
+			return nil
+		}
+	}
+	defaultPodSpec(ctx, &template.Spec, owner)
+	return nil
+}
+
+// WorkloadCustomValidator validates the pod templates of workloads
+type WorkloadCustomValidator struct{}
+
+var _ webhook.CustomValidator = &WorkloadCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the workload kinds.
+func (v *WorkloadCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return ValidateWorkload(ctx, obj)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the workload kinds.
+func (v *WorkloadCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	// Updates leaving the pod template unchanged (scale, labels, finalizers...) are not checked again,
+	// so they are not denied once the trust of an image running in the workload is revoked
+	if oldTemplate, _, err := getWorkloadPodTemplate(oldObj); err == nil {
+		if template, owner, err := getWorkloadPodTemplate(newObj); err == nil && equality.Semantic.DeepEqual(oldTemplate, template) &&
+			breakGlassUnchanged(oldObj.(metav1.Object), newObj.(metav1.Object)) {
+			owner.Log.Info("[🐾IntegrityPatrol] pod template unchanged, skip in~spec~tion ⏭️")
+			return nil, nil
+		}
+	}
+	return ValidateWorkload(ctx, newObj)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the workload kinds.
+func (v *WorkloadCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	// Do nothing on delete
+	return nil, nil
+}
+
+// Validate images of the pod template of a workload with the same rules as pods
+func ValidateWorkload(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	defer prometheus.NewTimer(metrics.GomenhashaiValidationDuration).ObserveDuration()
+	template, owner, err := getWorkloadPodTemplate(obj)
+	if err != nil {
+		return nil, err
+	}
+	if errs := workloadBreakGlassErrors(obj.(metav1.Object), template, owner); len(errs) > 0 {
+		owner.Log.Info("[🍣GomenHashai!] break-glass is not supported on workloads ❌")
+		return nil, apierrors.NewInvalid(owner.GroupKind, owner.Name, errs)
+	}
+	return validatePodSpec(ctx, &template.Spec, owner)
+}
+
+// Return if the update leaves the break-glass annotations of the workload unchanged
+func breakGlassUnchanged(oldMeta metav1.Object, meta metav1.Object) bool {
+	return oldMeta.GetAnnotations()[helpers.BreakGlassAnnotation] == meta.GetAnnotations()[helpers.BreakGlassAnnotation] &&
+		oldMeta.GetAnnotations()[helpers.BreakGlassExpiryAnnotation] == meta.GetAnnotations()[helpers.BreakGlassExpiryAnnotation]
+}
+
+// Return errors for the break-glass annotations of the workload and its pod template.
+// A break-glass is authorized for the user creating a pod, pods of workloads are created by their controller
+// so the break-glass would always be rejected: it must be set on pods created by hand during an incident.
+func workloadBreakGlassErrors(meta metav1.Object, template *corev1.PodTemplateSpec, owner podSpecOwner) field.ErrorList {
+	errs := field.ErrorList{}
+	for _, annotation := range []string{helpers.BreakGlassAnnotation, helpers.BreakGlassExpiryAnnotation} {
+		if _, found := meta.GetAnnotations()[annotation]; found {
+			errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(annotation), "break-glass is only supported on pods"))
+		}
+		if _, found := template.Annotations[annotation]; found {
+			errs = append(errs, field.Forbidden(owner.TemplatePath.Child("metadata", "annotations").Key(annotation), "break-glass is only supported on pods"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025 Marc-Antoine RAYMOND.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"github.com/GomenHashai/gomenhashai/internal/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Workload Webhook", func() {
+	var (
+		validator WorkloadCustomValidator
+		defaulter WorkloadCustomDefaulter
+		template  corev1.PodTemplateSpec
+	)
+
+	BeforeEach(func() {
+		validator = WorkloadCustomValidator{}
+		defaulter = WorkloadCustomDefaulter{}
+		template = corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "app",
+						Image: "busybox:stable",
+					},
+					{
+						Name:  "sidecar",
+						Image: "curlimages/curl:7",
+					},
+				},
+			},
+		}
+	})
+
+	Describe("Deployment", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = &appsv1.Deployment{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		})
+
+		It("Should add trusted digests to the pod template", func() {
+			Expect(defaulter.Default(context.Background(), deployment)).To(Succeed())
+			digest, err := helpers.GetTrustedDigest("busybox:stable")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.GetDigest(deployment.Spec.Template.Spec.Containers[0].Image)).To(Equal(digest))
+			Expect(helpers.GetDigest(deployment.Spec.Template.Spec.Containers[1].Image)).To(BeEmpty())
+		})
+		It("Should be denied with the path of the pod template", func() {
+			Expect(defaulter.Default(context.Background(), deployment)).To(Succeed())
+			warn, err := validator.ValidateCreate(context.Background(), deployment)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(HavePrefix("Deployment.apps \"test\" is invalid"))
+			Expect(err.Error()).To(ContainSubstring("spec.template.spec.containers[1].image"))
+		})
+		It("Should be allowed with trusted images", func() {
+			deployment.Spec.Template.Spec.Containers = deployment.Spec.Template.Spec.Containers[:1]
+			Expect(defaulter.Default(context.Background(), deployment)).To(Succeed())
+			warn, err := validator.ValidateCreate(context.Background(), deployment)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should not check again updates leaving the pod template unchanged", func() {
+			oldDeployment := deployment.DeepCopy()
+			deployment.Spec.Replicas = ptr.To[int32](3)
+			deployment.Labels = map[string]string{"team": "payments"}
+			deployment.Finalizers = []string{"example.com/cleanup"}
+			warn, err := validator.ValidateUpdate(context.Background(), oldDeployment, deployment)
+			Expect(warn).To(BeEmpty())
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should check updates changing the pod template", func() {
+			oldDeployment := deployment.DeepCopy()
+			deployment.Spec.Template.Labels = map[string]string{"version": "2"}
+			_, err := validator.ValidateUpdate(context.Background(), oldDeployment, deployment)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("Should reject break-glass annotations with a clear error", func() {
+			deployment.Spec.Template.Spec.Containers = deployment.Spec.Template.Spec.Containers[:1]
+			Expect(defaulter.Default(context.Background(), deployment)).To(Succeed())
+			deployment.Spec.Template.Annotations = map[string]string{helpers.BreakGlassAnnotation: "INC-1234"}
+			_, err := validator.ValidateCreate(context.Background(), deployment)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.template.metadata.annotations[gomenhashai.io/break-glass]: Forbidden: break-glass is only supported on pods"))
+
+			oldDeployment := deployment.DeepCopy()
+			oldDeployment.Spec.Template.Annotations = nil
+			deployment.Spec.Template.Annotations = nil
+			deployment.Annotations = map[string]string{helpers.BreakGlassAnnotation: "INC-1234"}
+			_, err = validator.ValidateUpdate(context.Background(), oldDeployment, deployment)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("metadata.annotations[gomenhashai.io/break-glass]: Forbidden"))
+		})
+	})
+
+	Describe("CronJob", func() {
+		It("Should be denied with the path of the job template", func() {
+			cronJob := &batchv1.CronJob{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: batchv1.CronJobSpec{
+					JobTemplate: batchv1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{Template: template},
+					},
+				},
+			}
+			Expect(defaulter.Default(context.Background(), cronJob)).To(Succeed())
+			Expect(helpers.GetDigest(cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)).ToNot(BeEmpty())
+			warn, err := validator.ValidateCreate(context.Background(), cronJob)
+			Expect(warn).To(BeEmpty())
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(HavePrefix("CronJob.batch \"test\" is invalid"))
+			Expect(err.Error()).To(ContainSubstring("spec.jobTemplate.spec.template.spec.containers[1].image"))
+		})
+	})
+
+	Describe("Job", func() {
+		It("Should not mutate the immutable pod template on update", func() {
+			job := &batchv1.Job{
+				ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       batchv1.JobSpec{Template: template},
+			}
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update},
+			})
+			Expect(defaulter.Default(ctx, job)).To(Succeed())
+			Expect(job.Spec.Template).To(Equal(template))
+		})
+	})
+
+	It("Should reject objects which are not workloads", func() {
+		Expect(defaulter.Default(context.Background(), &corev1.Pod{})).ToNot(Succeed())
+		_, err := validator.ValidateCreate(context.Background(), &corev1.Pod{})
+		Expect(err).To(HaveOccurred())
+	})
+})